@@ -0,0 +1,349 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the sensors, decorators and engine loop that depend on it, so tests and simulations can run
+// on a time of their own instead of the wall clock.
+type Clock interface {
+	Now() time.Time
+	// After returns a channel receiving the time once the duration has passed on the Clock
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the wall clock
+var Real Clock = wall{}
+
+type wall struct{}
+
+func (wall) Now() time.Time {
+	return time.Now()
+}
+
+func (wall) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (wall) timer(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTimer(d)
+	return t.C, func() {
+		t.Stop()
+	}
+}
+
+// stoppable is implemented by the clocks of this package, whose waits can be stopped before they fire
+type stoppable interface {
+	// timer returns the channel After would return, along with a function releasing the wait
+	timer(d time.Duration) (<-chan time.Time, func())
+}
+
+// timer waits for the duration on the Clock.  Stopping it releases the wait, unless the Clock does not support it.
+func timer(c Clock, d time.Duration) (<-chan time.Time, func()) {
+	if s, ok := c.(stoppable); ok {
+		return s.timer(d)
+	}
+	return c.After(d), func() {}
+}
+
+// OrReal returns the Clock, or the wall clock when it is nil
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Sleep waits for the duration to pass on the Clock, returning the error of the context if it is done first
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	expired, stop := timer(OrReal(c), d)
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-expired:
+		return nil
+	}
+}
+
+// Manual is a Clock that only moves when it is told to, so a test can step through a whole day instantly
+type Manual struct {
+	now     time.Time
+	waiters []*waiter
+	mutex   sync.Mutex
+}
+
+type waiter struct {
+	at      time.Time
+	channel chan time.Time
+}
+
+// NewManual returns a Manual clock set to the time
+func NewManual(now time.Time) *Manual {
+	return &Manual{now: now}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.now
+}
+
+func (m *Manual) After(d time.Duration) <-chan time.Time {
+	channel, _ := m.timer(d)
+	return channel
+}
+
+func (m *Manual) timer(d time.Duration) (<-chan time.Time, func()) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	w := &waiter{at: m.now.Add(d), channel: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.channel <- m.now
+		return w.channel, func() {}
+	}
+	m.waiters = append(m.waiters, w)
+	return w.channel, func() {
+		m.stop(w)
+	}
+}
+
+// stop drops the waiter, if it has not fired yet
+func (m *Manual) stop(w *waiter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, other := range m.waiters {
+		if other == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advance moves the clock forward by the duration, firing the channels of After that are due
+func (m *Manual) Advance(d time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.set(m.now.Add(d))
+}
+
+// Set moves the clock to the time, firing the channels of After that are due.  Setting the clock back does not
+// un-fire them.
+func (m *Manual) Set(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.set(now)
+}
+
+func (m *Manual) set(now time.Time) {
+	m.now = now
+	waiting := make([]*waiter, 0, len(m.waiters))
+	for _, w := range m.waiters {
+		if now.Before(w.at) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.channel <- now
+	}
+	m.waiters = waiting
+}
+
+// Scaled is a Clock running Factor times as fast as the Clock it is based on, starting from the time it is created
+type Scaled struct {
+	base   Clock
+	factor float64
+	origin time.Time
+}
+
+// NewScaled returns a Clock running factor times as fast as the base clock, e.g. 60 for a minute per second.  A factor
+// that is not positive leaves the time running at the speed of the base clock.
+func NewScaled(base Clock, factor float64) *Scaled {
+	base = OrReal(base)
+	if factor <= 0 {
+		factor = 1
+	}
+	return &Scaled{base: base, factor: factor, origin: base.Now()}
+}
+
+func (s *Scaled) Now() time.Time {
+	elapsed := s.base.Now().Sub(s.origin)
+	return s.origin.Add(time.Duration(float64(elapsed) * s.factor))
+}
+
+func (s *Scaled) After(d time.Duration) <-chan time.Time {
+	channel, _ := s.timer(d)
+	return channel
+}
+
+func (s *Scaled) timer(d time.Duration) (<-chan time.Time, func()) {
+	channel := make(chan time.Time, 1)
+	expired, stopBase := timer(s.base, time.Duration(float64(d)/s.factor))
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-expired:
+			channel <- s.Now()
+		case <-stopped:
+		}
+	}()
+	return channel, stopper(stopped, stopBase)
+}
+
+// stopper returns a function closing the channel and stopping the wait on the base clock, once however often it is
+// called
+func stopper(stopped chan struct{}, stopBase func()) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			stopBase()
+			close(stopped)
+		})
+	}
+}
+
+// Pausable is a Clock that stands still while it is paused, and carries on from where it stopped once resumed
+type Pausable struct {
+	base     Clock
+	paused   bool
+	pausedAt time.Time
+	offset   time.Duration
+	resumed  chan struct{}
+	mutex    sync.Mutex
+}
+
+// NewPausable returns a running Pausable clock following the base clock
+func NewPausable(base Clock) *Pausable {
+	return &Pausable{base: OrReal(base)}
+}
+
+func (p *Pausable) Now() time.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.now()
+}
+
+func (p *Pausable) now() time.Time {
+	if p.paused {
+		return p.pausedAt.Add(-p.offset)
+	}
+	return p.base.Now().Add(-p.offset)
+}
+
+// Pause stops the clock
+func (p *Pausable) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.paused {
+		return
+	}
+	p.paused = true
+	p.pausedAt = p.base.Now()
+	p.resumed = make(chan struct{})
+}
+
+// Resume starts the clock again, leaving out the time it was paused for
+func (p *Pausable) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	p.offset += p.base.Now().Sub(p.pausedAt)
+	close(p.resumed)
+}
+
+// Paused reports whether the clock is paused
+func (p *Pausable) Paused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.paused
+}
+
+func (p *Pausable) After(d time.Duration) <-chan time.Time {
+	channel, _ := p.timer(d)
+	return channel
+}
+
+func (p *Pausable) timer(d time.Duration) (<-chan time.Time, func()) {
+	channel := make(chan time.Time, 1)
+	deadline := p.Now().Add(d)
+	stopped := make(chan struct{})
+	go func() {
+		for {
+			p.mutex.Lock()
+			if p.paused {
+				resumed := p.resumed
+				p.mutex.Unlock()
+				select {
+				case <-resumed:
+					continue
+				case <-stopped:
+					return
+				}
+			}
+			now := p.now()
+			p.mutex.Unlock()
+			if !now.Before(deadline) {
+				channel <- now
+				return
+			}
+			// a pause while waiting leaves the deadline ahead of the clock, so the wait goes on after resuming
+			expired, stopBase := timer(p.base, deadline.Sub(now))
+			select {
+			case <-expired:
+			case <-stopped:
+				stopBase()
+				return
+			}
+		}
+	}()
+	return channel, stopper(stopped, func() {})
+}
+
+// deadlineContext is done once its deadline has passed on a Clock
+type deadlineContext struct {
+	context.Context
+	err   error
+	mutex sync.Mutex
+}
+
+func (c *deadlineContext) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return c.Context.Err()
+}
+
+// WithDeadline returns a context that is done once the deadline passes on the Clock, with DeadlineExceeded as its
+// error.  On the wall clock it is a plain context.WithDeadline.  Otherwise the context does not report the deadline,
+// since it is not a wall-clock time.  Cancelling the context releases its wait on the Clock.
+func WithDeadline(ctx context.Context, c Clock, deadline time.Time) (context.Context, context.CancelFunc) {
+	c = OrReal(c)
+	if c == Real {
+		return context.WithDeadline(ctx, deadline)
+	}
+	inner, cancel := context.WithCancel(ctx)
+	deadlineCtx := &deadlineContext{Context: inner}
+	expired, stop := timer(c, deadline.Sub(c.Now()))
+	go func() {
+		select {
+		case <-inner.Done():
+			stop()
+		case <-expired:
+			deadlineCtx.mutex.Lock()
+			deadlineCtx.err = context.DeadlineExceeded
+			deadlineCtx.mutex.Unlock()
+			cancel()
+		}
+	}()
+	return deadlineCtx, cancel
+}
+
+var _ Clock = &Manual{}
+var _ Clock = &Scaled{}
+var _ Clock = &Pausable{}
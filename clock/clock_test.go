@@ -0,0 +1,116 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+func waiters(m *Manual) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.waiters)
+}
+
+func TestManualFiresAfterOnceAdvancedPastTheDuration(t *testing.T) {
+	m := NewManual(epoch)
+	after := m.After(time.Hour)
+	m.Advance(59 * time.Minute)
+	select {
+	case <-after:
+		t.Fatal("expected After not to fire before the hour passed")
+	default:
+	}
+	m.Advance(time.Minute)
+	select {
+	case now := <-after:
+		if !now.Equal(epoch.Add(time.Hour)) {
+			t.Fatalf("expected After to fire at %v, got %v", epoch.Add(time.Hour), now)
+		}
+	default:
+		t.Fatal("expected After to fire once the hour passed")
+	}
+	if waiters(m) != 0 {
+		t.Fatalf("expected no waiters once After fired, got %d", waiters(m))
+	}
+}
+
+func TestManualDeadlineExpires(t *testing.T) {
+	m := NewManual(epoch)
+	ctx, cancel := WithDeadline(context.Background(), m, epoch.Add(time.Minute))
+	defer cancel()
+	m.Advance(time.Minute)
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", ctx.Err())
+	}
+}
+
+func TestCancellingADeadlineReleasesTheManualWaiter(t *testing.T) {
+	m := NewManual(epoch)
+	ctx, cancel := WithDeadline(context.Background(), m, epoch.Add(time.Minute))
+	if waiters(m) != 1 {
+		t.Fatalf("expected the deadline to wait on the clock, got %d waiters", waiters(m))
+	}
+	cancel()
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Fatalf("expected the context to be cancelled, got %v", ctx.Err())
+	}
+	deadline := time.Now().Add(time.Second)
+	for waiters(m) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the waiter to be released, got %d waiters", waiters(m))
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestCancellingADeadlineStopsTheScaledWait(t *testing.T) {
+	m := NewManual(epoch)
+	scaled := NewScaled(m, 60)
+	ctx, cancel := WithDeadline(context.Background(), scaled, epoch.Add(time.Hour))
+	cancel()
+	<-ctx.Done()
+	deadline := time.Now().Add(time.Second)
+	for waiters(m) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the wait on the base clock to be released, got %d waiters", waiters(m))
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestScaledRunsFasterThanItsBase(t *testing.T) {
+	m := NewManual(epoch)
+	scaled := NewScaled(m, 60)
+	after := scaled.After(time.Hour)
+	m.Advance(time.Minute)
+	select {
+	case now := <-after:
+		if !now.Equal(epoch.Add(time.Hour)) {
+			t.Fatalf("expected an hour to pass on the scaled clock, got %v", now.Sub(epoch))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an hour on the scaled clock to pass in a minute of its base")
+	}
+}
+
+func TestPausableStandsStillWhilePaused(t *testing.T) {
+	m := NewManual(epoch)
+	pausable := NewPausable(m)
+	pausable.Pause()
+	m.Advance(time.Hour)
+	if !pausable.Now().Equal(epoch) {
+		t.Fatalf("expected the paused clock to stand still, got %v", pausable.Now())
+	}
+	pausable.Resume()
+	m.Advance(time.Minute)
+	if !pausable.Now().Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("expected the clock to carry on from where it stopped, got %v", pausable.Now())
+	}
+}
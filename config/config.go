@@ -7,4 +7,14 @@ type Config struct {
 	TaskPath      string `json:"taskPath"`
 	TaskGraphPath string `json:"taskGraphPath"`
 	MethodPath    string `json:"methodPath"`
+	LogLevel      string `json:"logLevel,omitempty"`
+	LogFormat     string `json:"logFormat,omitempty"`
+	// MetricsAddress is the address the Prometheus metrics are served on, e.g. "127.0.0.1:9464"
+	MetricsAddress string `json:"metricsAddress,omitempty"`
+	// TimeScale runs the clock of the engine faster than the wall clock, e.g. 60 for a minute per second
+	TimeScale float64 `json:"timeScale,omitempty"`
+	// SnapshotPath is the file the engine is restored from on startup and saved to after every tick
+	SnapshotPath string `json:"snapshotPath,omitempty"`
+	// WatchAssets reloads the domain into the running engine whenever its asset files change
+	WatchAssets bool `json:"watchAssets,omitempty"`
 }
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Goal is an entry of an Agent's agenda.  Task names the task of the Domain that pursues the goal, and the goal with
+// the highest Priority that can be planned drives planning.  Goals of equal priority are pursued in the order they
+// were pushed.  A goal is dropped from the agenda once its task is complete, unless it is Persistent.
+type Goal struct {
+	Name       string
+	Task       string
+	Priority   int
+	Persistent bool
+	sequence   int64
+	preempted  bool
+}
+
+func (g *Goal) String() string {
+	return fmt.Sprintf("%s: task %s, priority %d", g.Name, g.Task, g.Priority)
+}
+
+// Agenda holds the goals pushed to an Agent at runtime.  It is safe to change the agenda while the Agent is planning.
+type Agenda struct {
+	goals    []*Goal
+	sequence int64
+	mutex    sync.Mutex
+}
+
+// Push adds a goal to the agenda
+func (a *Agenda) Push(goal *Goal) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, existing := range a.goals {
+		if existing.Name == goal.Name {
+			return fmt.Errorf("goal %s is already on the agenda", goal.Name)
+		}
+	}
+	a.sequence++
+	goal.sequence = a.sequence
+	a.goals = append(a.goals, goal)
+	return nil
+}
+
+// Remove drops the named goal from the agenda and reports whether it was there
+func (a *Agenda) Remove(name string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for i, goal := range a.goals {
+		if goal.Name == name {
+			a.goals = append(a.goals[:i], a.goals[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Goals returns the goals in the order they are arbitrated: highest priority first, then in the order they were pushed
+func (a *Agenda) Goals() []*Goal {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	goals := make([]*Goal, len(a.goals))
+	copy(goals, a.goals)
+	sort.SliceStable(goals, func(i, j int) bool {
+		if goals[i].Priority != goals[j].Priority {
+			return goals[i].Priority > goals[j].Priority
+		}
+		return goals[i].sequence < goals[j].sequence
+	})
+	return goals
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"github.com/cory-johannsen/gohtn/logging"
+	"math/rand"
+)
+
+type Agents map[string]*Agent
+
+// Agent holds the runtime instances of one actor running a Domain: its own State, task instances with their status,
+// and the Planner and Executor working on them.  Agents never share task instances, so each one can run on its own
+// goroutine.
+type Agent struct {
+	Name          string
+	Logger        logging.Logger
+	Clock         clock.Clock
+	State         *gohtn.State
+	TaskResolvers gohtn.TaskResolvers
+	Tasks         gohtn.Tasks
+	Methods       Methods
+	Graph         *gohtn.TaskGraph
+	Planner       *gohtn.Planner
+	Executor      *gohtn.Executor
+	Agenda        *Agenda
+	Random        *rand.Rand
+	source        *randomSource
+	active        *Goal
+	activeRoots   []gohtn.Task
+}
+
+// Plan builds the plan for the next tick from the highest priority goal that can be planned, or from the task graph
+// when none can.  Switching goals cancels the Running tasks of the goal that was active.
+func (a *Agent) Plan() (*gohtn.Plan, error) {
+	for _, goal := range a.Agenda.Goals() {
+		task, err := a.resolve(goal.Task)
+		if err != nil {
+			return nil, err
+		}
+		roots := []gohtn.Task{task}
+		if g, ok := task.(*gohtn.GoalTask); ok {
+			g.Evaluate(a.State)
+		}
+		if task.IsComplete() {
+			if !goal.Persistent {
+				a.log().Info("goal achieved", logging.F("goal", goal.String()))
+				a.Agenda.Remove(goal.Name)
+			}
+			continue
+		}
+		planner := &gohtn.Planner{
+			Tasks:    &gohtn.TaskGraph{Root: &gohtn.TaskNode{TaskResolver: a.TaskResolvers[goal.Task]}},
+			MaxDepth: a.Planner.MaxDepth,
+			Strategy: a.Planner.Strategy,
+			Events:   a.Planner.Events,
+			Clock:    a.Planner.Clock,
+			Logger:   a.Planner.Logger,
+			Metrics:  a.Planner.Metrics,
+		}
+		plan, err := planner.Plan(a.State)
+		if err != nil {
+			var planningError *gohtn.PlanningError
+			if !errors.As(err, &planningError) {
+				return nil, err
+			}
+			a.log().Info("goal can not be planned", logging.F("goal", goal.String()), logging.Err(err))
+			continue
+		}
+		if len(plan.Tasks) == 0 {
+			continue
+		}
+		a.activate(goal, planner, roots)
+		return plan, nil
+	}
+	roots, err := a.Graph.Network()
+	if err != nil {
+		return nil, err
+	}
+	a.activate(nil, a.Planner, roots)
+	return a.Planner.Plan(a.State)
+}
+
+// ActiveGoal returns the goal driving the current plan, or nil when the task graph of the Domain drives it
+func (a *Agent) ActiveGoal() *Goal {
+	return a.active
+}
+
+// activate makes the goal drive execution, preempting the goal that was active before it
+func (a *Agent) activate(goal *Goal, planner *gohtn.Planner, roots []gohtn.Task) {
+	if goal != a.active {
+		if a.active != nil {
+			a.log().Info("goal is no longer active, cancelling its running tasks", logging.F("goal", a.active.String()))
+			a.active.preempted = true
+		}
+		for _, root := range a.activeRoots {
+			err := gohtn.CancelSubtree(root)
+			if err != nil {
+				a.log().Warn("cancelling the tasks of the goal", logging.Task(root.Name()), logging.Err(err))
+			}
+		}
+		a.Executor.Forget()
+		if goal != nil && goal.preempted {
+			a.log().Info("resuming goal", logging.F("goal", goal.String()))
+			goal.preempted = false
+		}
+	}
+	a.active = goal
+	a.activeRoots = roots
+	a.Executor.Planner = planner
+}
+
+func (a *Agent) log() logging.Logger {
+	return logging.OrNop(a.Logger)
+}
+
+func (a *Agent) resolve(name string) (gohtn.Task, error) {
+	taskResolver, ok := a.TaskResolvers[name]
+	if !ok {
+		return nil, fmt.Errorf("agent %s has no task with name %s", a.Name, name)
+	}
+	return taskResolver()
+}
+
+// ApplyResetPolicies advances the tick of decorated tasks and returns finished tasks to Pending according to their
+// reset policies.  It is called once per tick, before planning, so repeatable tasks can be planned again in the same
+// tick they are reset.  Instances bound to an actor that has left the State are evicted first.  The Planner and
+// Executor log the tick from then on.
+func (a *Agent) ApplyResetPolicies(tick int64) {
+	logger := a.log().With(logging.Tick(tick))
+	a.Planner.Logger = logger
+	a.Executor.Logger = logger
+	for _, task := range a.Tasks {
+		gohtn.Evict(task, a.State.Actors)
+		for _, instance := range gohtn.Instances(task) {
+			if ticker, ok := instance.(gohtn.Ticker); ok {
+				ticker.Advance(tick)
+			}
+			gohtn.ApplyResetPolicy(instance, a.State, tick)
+		}
+	}
+}
+
+// ResetSubtree returns the named task and every task it can decompose into to Pending
+func (a *Agent) ResetSubtree(name string) error {
+	task, err := a.resolve(name)
+	if err != nil {
+		return err
+	}
+	return gohtn.ResetSubtree(task)
+}
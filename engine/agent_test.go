@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"testing"
+)
+
+// testInstantiator instantiates the tasks built by the function for every Agent
+type testInstantiator struct {
+	tasks func() []gohtn.Task
+}
+
+func (i *testInstantiator) Instantiate(domain *Domain, agent *Agent) error {
+	for _, task := range i.tasks() {
+		task := task
+		agent.Tasks[task.Name()] = task
+		agent.TaskResolvers[task.Name()] = func() (gohtn.Task, error) {
+			return task, nil
+		}
+	}
+	agent.Graph = &gohtn.TaskGraph{}
+	return nil
+}
+
+func primitive(name string, status gohtn.TaskStatus) *gohtn.PrimitiveTask {
+	return &gohtn.PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *gohtn.State) (gohtn.TaskStatus, error) {
+			return status, nil
+		},
+	}
+}
+
+func compound(name string, subtasks ...gohtn.Task) *gohtn.CompoundTask {
+	method := &gohtn.Method{Name: name, TaskResolvers: make(gohtn.TaskResolvers)}
+	for _, subtask := range subtasks {
+		subtask := subtask
+		method.Tasks = append(method.Tasks, subtask.Name())
+		method.TaskResolvers[subtask.Name()] = func() (gohtn.Task, error) {
+			return subtask, nil
+		}
+	}
+	return &gohtn.CompoundTask{TaskName: name, Methods: []*gohtn.Method{method}}
+}
+
+func newState() *gohtn.State {
+	return &gohtn.State{Properties: make(map[string]any), Sensors: make(map[string]any)}
+}
+
+func TestPreemptingAGoalCancelsItsRunningSubtasks(t *testing.T) {
+	walk := primitive("Walk", gohtn.Running)
+	greet := primitive("Greet", gohtn.Succeeded)
+	patrol := compound("Patrol", walk)
+	chat := compound("Chat", greet)
+	engine := &Engine{Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+		return []gohtn.Task{patrol, chat}
+	}}}}
+	_, err := engine.AddAgent("Vendor", newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.PushGoal("Vendor", &Goal{Name: "patrol", Task: "Patrol", Priority: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Tick(context.Background())
+	if walk.Status() != gohtn.Running || patrol.Status() != gohtn.Running {
+		t.Fatalf("expected the patrol to be running, got %s and %s", patrol.Status(), walk.Status())
+	}
+	err = engine.PushGoal("Vendor", &Goal{Name: "chat", Task: "Chat", Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Tick(context.Background())
+	if walk.Status() != gohtn.Cancelled {
+		t.Fatalf("expected the preempted walk to be cancelled, got %s", walk.Status())
+	}
+	if chat.Status() != gohtn.Succeeded {
+		t.Fatalf("expected the chat to succeed, got %s", chat.Status())
+	}
+}
+
+func TestACompletedCompoundGoalIsDropped(t *testing.T) {
+	greet := primitive("Greet", gohtn.Succeeded)
+	chat := compound("Chat", greet)
+	engine := &Engine{Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+		return []gohtn.Task{chat}
+	}}}}
+	_, err := engine.AddAgent("Vendor", newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.PushGoal("Vendor", &Goal{Name: "chat", Task: "Chat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Tick(context.Background())
+	engine.Tick(context.Background())
+	goals, err := engine.Goals("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 0 {
+		t.Fatalf("expected the achieved goal to be dropped, got %v", goals)
+	}
+}
+
+func TestTheEventsOfAGoalAreStampedWithTheTimeOnTheClock(t *testing.T) {
+	chat := compound("Chat", primitive("Greet", gohtn.Succeeded))
+	engine := &Engine{
+		Clock: clock.NewManual(epoch),
+		Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+			return []gohtn.Task{chat}
+		}}},
+	}
+	events := make([]gohtn.Event, 0)
+	engine.Events.Subscribe(func(event gohtn.Event) {
+		events = append(events, event)
+	})
+	_, err := engine.AddAgent("Vendor", newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.PushGoal("Vendor", &Goal{Name: "chat", Task: "Chat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Tick(context.Background())
+	planned := false
+	for _, event := range events {
+		planned = planned || event.Type == gohtn.PlanBuilt
+		if !event.Time.Equal(epoch) {
+			t.Fatalf("expected the %s event at %v, got %v", event.Type, epoch, event.Time)
+		}
+	}
+	if !planned {
+		t.Fatalf("expected the plan of the goal to be built, got %v", events)
+	}
+}
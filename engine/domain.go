@@ -0,0 +1,21 @@
+package engine
+
+import "github.com/cory-johannsen/gohtn/gohtn"
+
+// Instantiator creates the runtime task instances of an Agent from a compiled Domain
+type Instantiator interface {
+	Instantiate(domain *Domain, agent *Agent) error
+}
+
+// Domain is the compiled definition of an HTN, shared by every Agent that runs it.  The Instantiator builds each
+// Agent's own task instances.  A Domain is not changed once agents are running it; Engine.Reload swaps in a new one.
+type Domain struct {
+	Conditions      Conditions
+	ActorConditions ActorConditions
+	Actions         Actions
+	Scorers         Scorers
+	Instantiator    Instantiator
+	Strategy        gohtn.Strategy
+	MaxDepth        int
+	Rollback        bool
+}
@@ -1,23 +1,224 @@
 package engine
 
 import (
+	"fmt"
 	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/clock"
 	"github.com/cory-johannsen/gohtn/gohtn"
+	"github.com/cory-johannsen/gohtn/logging"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
 )
 
-type Actions map[string]gohtn.Action
+// Actions registers the actions of a Domain by name.  Use gohtn.WithContext to register an Action that does not take
+// a context.
+type Actions map[string]gohtn.ContextAction
 type Conditions map[string]gohtn.Condition
+type ActorConditions map[string]gohtn.ActorCondition
+type Scorers map[string]gohtn.Scorer
 
 type Methods map[string]*gohtn.Method
 
+// Engine runs the agents of a Domain on its Clock.  A seeded Random source makes the random choices of the agents
+// reproducible as long as they are added in the same order.
 type Engine struct {
-	Actors        actor.Actors
-	Sensors       gohtn.Sensors
-	Actions       Actions
-	Conditions    Conditions
-	TaskResolvers gohtn.TaskResolvers
-	Tasks         gohtn.Tasks
-	Methods       Methods
-	Planner       *gohtn.Planner
-	Domain        *gohtn.TaskGraph
+	Actors    actor.Actors
+	Sensors   gohtn.Sensors
+	Domain    *Domain
+	Random    rand.Source
+	Events    EventBus
+	Logger    logging.Logger
+	Metrics   gohtn.Metrics
+	Clock     clock.Clock
+	TickRate  time.Duration
+	AfterTick func(result *TickResult)
+	agents    Agents
+	tick      int64
+	mutex     sync.RWMutex
+	tickMutex sync.Mutex
+}
+
+// AddAgent instantiates the Domain for a new Agent observing the given State.  A State without a Logger of its own logs
+// through the Logger of the Agent.  Agents are added between ticks, like a Reload, so an Agent added while the Domain
+// is reloaded is built from the new Domain, and AddAgent must not be called from the actions of a tick.
+func (e *Engine) AddAgent(name string, state *gohtn.State) (*Agent, error) {
+	e.tickMutex.Lock()
+	defer e.tickMutex.Unlock()
+	e.mutex.RLock()
+	domain := e.Domain
+	e.mutex.RUnlock()
+	logger := logging.OrNop(e.Logger).With(logging.Agent(name))
+	if state.Logger == nil {
+		state.Logger = logger
+	}
+	agent, err := e.newAgent(name, state, domain, logger, newRandomSource(e.seed()))
+	if err != nil {
+		return nil, err
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.agents == nil {
+		e.agents = make(Agents)
+	}
+	if _, ok := e.agents[name]; ok {
+		return nil, fmt.Errorf("agent %s already exists", name)
+	}
+	e.agents[name] = agent
+	return agent, nil
+}
+
+// newAgent instantiates the domain for an Agent observing the State
+func (e *Engine) newAgent(name string, state *gohtn.State, domain *Domain, logger logging.Logger, source *randomSource) (*Agent, error) {
+	if domain == nil || domain.Instantiator == nil {
+		return nil, fmt.Errorf("engine has no compiled domain")
+	}
+	if source == nil {
+		source = newRandomSource(e.seed())
+	}
+	agent := &Agent{
+		Name:          name,
+		Logger:        logger,
+		Clock:         clock.OrReal(e.Clock),
+		Random:        rand.New(source),
+		source:        source,
+		State:         state,
+		TaskResolvers: make(gohtn.TaskResolvers),
+		Tasks:         make(gohtn.Tasks),
+		Methods:       make(Methods),
+		Agenda:        &Agenda{},
+	}
+	err := domain.Instantiator.Instantiate(domain, agent)
+	if err != nil {
+		return nil, fmt.Errorf("agent %s: %w", name, err)
+	}
+	events := &agentEvents{agent: name, bus: &e.Events}
+	var metrics gohtn.Metrics
+	if e.Metrics != nil {
+		metrics = &agentMetrics{agent: name, metrics: e.Metrics}
+	}
+	agent.Planner = &gohtn.Planner{
+		Tasks:    agent.Graph,
+		MaxDepth: domain.MaxDepth,
+		Strategy: domain.Strategy,
+		Events:   events,
+		Clock:    agent.Clock,
+		Logger:   logger,
+		Metrics:  metrics,
+	}
+	agent.Executor = &gohtn.Executor{
+		Planner:  agent.Planner,
+		Rollback: domain.Rollback,
+		Events:   events,
+		Clock:    agent.Clock,
+		Logger:   logger,
+		Metrics:  metrics,
+	}
+	return agent, nil
+}
+
+func (e *Engine) RemoveAgent(name string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.agents, name)
+}
+
+func (e *Engine) Agent(name string) (*Agent, error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	agent, ok := e.agents[name]
+	if !ok {
+		return nil, fmt.Errorf("no agent with name %s", name)
+	}
+	return agent, nil
+}
+
+// seed draws the seed of an agent's random source
+func (e *Engine) seed() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.Random == nil {
+		return time.Now().UnixNano()
+	}
+	return e.Random.Int63()
+}
+
+// randomSource is the random source of an Agent.  It counts its draws, so its state can be recorded as the seed and
+// the number of draws, and restored by replaying them.
+type randomSource struct {
+	seed   int64
+	draws  int64
+	source rand.Source
+}
+
+func newRandomSource(seed int64) *randomSource {
+	return &randomSource{seed: seed, source: rand.NewSource(seed)}
+}
+
+func (r *randomSource) Int63() int64 {
+	r.draws++
+	return r.source.Int63()
+}
+
+func (r *randomSource) Seed(seed int64) {
+	r.seed = seed
+	r.draws = 0
+	r.source.Seed(seed)
+}
+
+// restore seeds the source and replays the draws
+func (r *randomSource) restore(seed int64, draws int64) {
+	r.Seed(seed)
+	for i := int64(0); i < draws; i++ {
+		r.Int63()
+	}
+}
+
+// PushGoal adds a goal to the agenda of the named agent.  The goal task must be part of the Domain.
+func (e *Engine) PushGoal(agentName string, goal *Goal) error {
+	agent, err := e.Agent(agentName)
+	if err != nil {
+		return err
+	}
+	if _, ok := agent.TaskResolvers[goal.Task]; !ok {
+		return fmt.Errorf("goal %s task %s not found", goal.Name, goal.Task)
+	}
+	return agent.Agenda.Push(goal)
+}
+
+// RemoveGoal drops a goal from the agenda of the named agent.  The tasks of an active goal are cancelled when the
+// agent next plans.
+func (e *Engine) RemoveGoal(agentName string, goalName string) error {
+	agent, err := e.Agent(agentName)
+	if err != nil {
+		return err
+	}
+	if !agent.Agenda.Remove(goalName) {
+		return fmt.Errorf("agent %s has no goal with name %s", agentName, goalName)
+	}
+	return nil
+}
+
+// Goals returns the agenda of the named agent in priority order
+func (e *Engine) Goals(agentName string) ([]*Goal, error) {
+	agent, err := e.Agent(agentName)
+	if err != nil {
+		return nil, err
+	}
+	return agent.Agenda.Goals(), nil
+}
+
+// Agents returns the running agents ordered by name
+func (e *Engine) Agents() []*Agent {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	agents := make([]*Agent, 0, len(e.agents))
+	for _, agent := range e.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	return agents
 }
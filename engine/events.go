@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"github.com/cory-johannsen/gohtn/logging"
+	"sync"
+	"sync/atomic"
+)
+
+// Handler receives the events of a Subscription
+type Handler func(event gohtn.Event)
+
+// Filter selects the events a Subscription receives
+type Filter func(event gohtn.Event) bool
+
+// Types selects events of the given types
+func Types(types ...gohtn.EventType) Filter {
+	return func(event gohtn.Event) bool {
+		for _, eventType := range types {
+			if event.Type == eventType {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ForAgent selects the events of the named agent
+func ForAgent(name string) Filter {
+	return func(event gohtn.Event) bool {
+		return event.Agent == name
+	}
+}
+
+// Subscription is a Handler registered with an EventBus.  A synchronous Subscription is handed each event on the
+// goroutine that emitted it, so its Handler should return quickly and may be called concurrently.  An asynchronous
+// Subscription queues events in a buffer drained by a goroutine of its own, and drops the events that do not fit.
+type Subscription struct {
+	filters []Filter
+	handler Handler
+	queue   chan gohtn.Event
+	dropped atomic.Int64
+	done    chan struct{}
+	closed  bool
+	mutex   sync.Mutex
+}
+
+func (s *Subscription) accepts(event gohtn.Event) bool {
+	for _, filter := range s.filters {
+		if !filter(event) {
+			return false
+		}
+	}
+	return true
+}
+
+// Dropped returns the number of events an asynchronous Subscription dropped because its buffer was full
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscription) deliver(event gohtn.Event, logger logging.Logger) {
+	if s.queue == nil {
+		s.handler(event)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped.Add(1)
+		logger.Warn("event bus subscription buffer full, dropping event", logging.F("event", event.String()))
+	}
+}
+
+func (s *Subscription) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	close(s.queue)
+}
+
+func (s *Subscription) drain() {
+	defer close(s.done)
+	for event := range s.queue {
+		s.handler(event)
+	}
+}
+
+// EventBus publishes the planning and execution events of the agents of an Engine to its subscribers.  Subscriptions
+// receive the events that pass all of their filters.  Dropped events are logged to the Logger.  The zero value is
+// ready to use.
+type EventBus struct {
+	Logger        logging.Logger
+	subscriptions []*Subscription
+	mutex         sync.RWMutex
+}
+
+// Subscribe registers a synchronous Handler for the events passing the filters
+func (b *EventBus) Subscribe(handler Handler, filters ...Filter) *Subscription {
+	subscription := &Subscription{filters: filters, handler: handler}
+	b.add(subscription)
+	return subscription
+}
+
+// SubscribeAsync registers a Handler that receives the events passing the filters on a goroutine of its own, through
+// a buffer holding up to buffer events
+func (b *EventBus) SubscribeAsync(handler Handler, buffer int, filters ...Filter) *Subscription {
+	subscription := &Subscription{
+		filters: filters,
+		handler: handler,
+		queue:   make(chan gohtn.Event, buffer),
+		done:    make(chan struct{}),
+	}
+	go subscription.drain()
+	b.add(subscription)
+	return subscription
+}
+
+func (b *EventBus) add(subscription *Subscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions = append(b.subscriptions, subscription)
+}
+
+// Unsubscribe removes the Subscription.  An asynchronous Subscription handles the events already in its buffer before
+// Unsubscribe returns, so it can not be unsubscribed from its own Handler.
+func (b *EventBus) Unsubscribe(subscription *Subscription) {
+	b.mutex.Lock()
+	removed := false
+	for i, existing := range b.subscriptions {
+		if existing == subscription {
+			b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	b.mutex.Unlock()
+	if removed && subscription.queue != nil {
+		subscription.close()
+		<-subscription.done
+	}
+}
+
+// Emit publishes the event to every Subscription whose filters it passes.  Handlers may subscribe and unsubscribe
+// while handling an event.
+func (b *EventBus) Emit(event gohtn.Event) {
+	b.mutex.RLock()
+	subscriptions := b.subscriptions
+	b.mutex.RUnlock()
+	for _, subscription := range subscriptions {
+		if subscription.accepts(event) {
+			subscription.deliver(event, logging.OrNop(b.Logger))
+		}
+	}
+}
+
+// agentEvents stamps the events of an Agent with its name before publishing them on the bus
+type agentEvents struct {
+	agent string
+	bus   *EventBus
+}
+
+func (a *agentEvents) Emit(event gohtn.Event) {
+	event.Agent = a.agent
+	a.bus.Emit(event)
+}
+
+var _ gohtn.Emitter = &EventBus{}
+var _ gohtn.Emitter = &agentEvents{}
@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"sync"
+	"testing"
+)
+
+// collector keeps the events handed to its Handler
+type collector struct {
+	events []gohtn.Event
+	mutex  sync.Mutex
+}
+
+func (c *collector) handle(event gohtn.Event) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *collector) tasks() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tasks := make([]string, 0, len(c.events))
+	for _, event := range c.events {
+		tasks = append(tasks, event.Task)
+	}
+	return tasks
+}
+
+func expectTasks(t *testing.T, c *collector, expected ...string) {
+	t.Helper()
+	tasks := c.tasks()
+	if len(tasks) != len(expected) {
+		t.Fatalf("expected the events of %v, got %v", expected, tasks)
+	}
+	for i := range tasks {
+		if tasks[i] != expected[i] {
+			t.Fatalf("expected the events of %v, got %v", expected, tasks)
+		}
+	}
+}
+
+func TestSubscriptionsReceiveTheEventsPassingAllTheirFilters(t *testing.T) {
+	bus := &EventBus{}
+	all, failures, vendorFailures := &collector{}, &collector{}, &collector{}
+	bus.Subscribe(all.handle)
+	bus.Subscribe(failures.handle, Types(gohtn.TaskFailed, gohtn.TaskCancelled))
+	bus.Subscribe(vendorFailures.handle, Types(gohtn.TaskFailed), ForAgent("Vendor"))
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Agent: "Vendor", Task: "Greet"})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskFailed, Agent: "Vendor", Task: "Trade"})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskFailed, Agent: "Guard", Task: "Patrol"})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskCancelled, Agent: "Guard", Task: "Chase"})
+	expectTasks(t, all, "Greet", "Trade", "Patrol", "Chase")
+	expectTasks(t, failures, "Trade", "Patrol", "Chase")
+	expectTasks(t, vendorFailures, "Trade")
+}
+
+func TestAgentEventsAreStampedWithTheAgentName(t *testing.T) {
+	bus := &EventBus{}
+	vendor := &collector{}
+	bus.Subscribe(vendor.handle, ForAgent("Vendor"))
+	(&agentEvents{agent: "Vendor", bus: bus}).Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Greet"})
+	(&agentEvents{agent: "Guard", bus: bus}).Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Patrol"})
+	expectTasks(t, vendor, "Greet")
+}
+
+func TestAsyncSubscriptionsHandleTheBufferedEventsBeforeUnsubscribing(t *testing.T) {
+	bus := &EventBus{}
+	async := &collector{}
+	subscription := bus.SubscribeAsync(async.handle, 10)
+	for _, task := range []string{"Greet", "Trade", "Wave"} {
+		bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: task})
+	}
+	bus.Unsubscribe(subscription)
+	expectTasks(t, async, "Greet", "Trade", "Wave")
+	if subscription.Dropped() != 0 {
+		t.Fatalf("expected no event to be dropped, got %d", subscription.Dropped())
+	}
+}
+
+func TestAsyncSubscriptionsDropTheEventsThatDoNotFit(t *testing.T) {
+	bus := &EventBus{}
+	async := &collector{}
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	subscription := bus.SubscribeAsync(func(event gohtn.Event) {
+		if event.Task == "Greet" {
+			close(handling)
+			<-release
+		}
+		async.handle(event)
+	}, 1)
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Greet"})
+	<-handling
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Trade"})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Wave"})
+	if subscription.Dropped() != 1 {
+		t.Fatalf("expected the event past the full buffer to be dropped, got %d", subscription.Dropped())
+	}
+	close(release)
+	bus.Unsubscribe(subscription)
+	expectTasks(t, async, "Greet", "Trade")
+}
+
+func TestUnsubscribedHandlersReceiveNoMoreEvents(t *testing.T) {
+	bus := &EventBus{}
+	direct, async, remaining := &collector{}, &collector{}, &collector{}
+	directSubscription := bus.Subscribe(direct.handle)
+	asyncSubscription := bus.SubscribeAsync(async.handle, 10)
+	bus.Subscribe(remaining.handle)
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Greet"})
+	bus.Unsubscribe(directSubscription)
+	bus.Unsubscribe(asyncSubscription)
+	bus.Unsubscribe(asyncSubscription)
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Trade"})
+	expectTasks(t, direct, "Greet")
+	expectTasks(t, async, "Greet")
+	expectTasks(t, remaining, "Greet", "Trade")
+}
+
+func TestAHandlerMayUnsubscribeItself(t *testing.T) {
+	bus := &EventBus{}
+	once := &collector{}
+	var subscription *Subscription
+	subscription = bus.Subscribe(func(event gohtn.Event) {
+		once.handle(event)
+		bus.Unsubscribe(subscription)
+	})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Greet"})
+	bus.Emit(gohtn.Event{Type: gohtn.TaskStarted, Task: "Trade"})
+	expectTasks(t, once, "Greet")
+}
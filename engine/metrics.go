@@ -0,0 +1,28 @@
+package engine
+
+import "github.com/cory-johannsen/gohtn/gohtn"
+
+// agentMetrics labels the metrics of an Agent with its name before handing them to the Metrics of the Engine
+type agentMetrics struct {
+	agent   string
+	metrics gohtn.Metrics
+}
+
+func (a *agentMetrics) Add(name string, labels gohtn.Labels, delta float64) {
+	a.metrics.Add(name, a.label(labels), delta)
+}
+
+func (a *agentMetrics) Observe(name string, labels gohtn.Labels, value float64) {
+	a.metrics.Observe(name, a.label(labels), value)
+}
+
+func (a *agentMetrics) label(labels gohtn.Labels) gohtn.Labels {
+	labelled := make(gohtn.Labels, len(labels)+1)
+	for name, value := range labels {
+		labelled[name] = value
+	}
+	labelled["agent"] = a.agent
+	return labelled
+}
+
+var _ gohtn.Metrics = &agentMetrics{}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"github.com/cory-johannsen/gohtn/logging"
+	"sort"
+)
+
+// Reload swaps a new Domain into the running Engine between two ticks.  A Domain that fails to instantiate or resolve
+// is rejected with an error, leaving the Engine as it was.
+func (e *Engine) Reload(domain *Domain) error {
+	e.tickMutex.Lock()
+	defer e.tickMutex.Unlock()
+	agents := make(Agents)
+	for _, agent := range e.Agents() {
+		reloaded, err := e.newAgent(agent.Name, agent.State, domain, agent.Logger, agent.source)
+		if err != nil {
+			return err
+		}
+		err = reloaded.resolveReachable(agent)
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", agent.Name, err)
+		}
+		err = reloaded.carryOver(agent.snapshot())
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", agent.Name, err)
+		}
+		agents[agent.Name] = reloaded
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.Domain = domain
+	for name, agent := range agents {
+		e.agents[name] = agent
+	}
+	logging.OrNop(e.Logger).Info("domain reloaded", logging.Tick(e.tick), logging.F("agents", len(agents)))
+	return nil
+}
+
+// resolveReachable instantiates every task the Agent can plan, so their references are checked before the swap
+func (a *Agent) resolveReachable(previous *Agent) error {
+	roots, err := a.Graph.Network()
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(previous.Tasks))
+	for name := range previous.Tasks {
+		names = append(names, name)
+	}
+	for _, goal := range previous.Agenda.Goals() {
+		names = append(names, goal.Task)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := a.TaskResolvers[name]; !ok {
+			continue
+		}
+		root, err := a.resolve(name)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+	for _, root := range roots {
+		_, err := gohtn.Subtree(root)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// carryOver restores the state of the tasks and goals the new Domain still has, starting incompatible tasks over
+func (a *Agent) carryOver(snapshot *AgentSnapshot) error {
+	for _, taskSnapshot := range snapshot.Tasks {
+		if _, ok := a.TaskResolvers[taskSnapshot.Name]; !ok {
+			a.log().Warn("task was removed from the domain, dropping its state", logging.Task(taskSnapshot.Name))
+			continue
+		}
+		task, err := a.resolve(taskSnapshot.Name)
+		if err != nil {
+			return err
+		}
+		err = gohtn.RestoreTask(task, taskSnapshot, a.State)
+		if err != nil {
+			a.log().Warn("task changed incompatibly, starting it over", logging.Task(taskSnapshot.Name), logging.Err(err))
+			task.Reset()
+			for _, instance := range gohtn.Instances(task) {
+				instance.Reset()
+			}
+		}
+	}
+	goals := make([]*GoalSnapshot, 0, len(snapshot.Goals))
+	for _, goal := range snapshot.Goals {
+		if _, ok := a.TaskResolvers[goal.Task]; !ok {
+			a.log().Warn("goal task was removed from the domain, dropping the goal", logging.F("goal", goal.Name), logging.Task(goal.Task))
+			continue
+		}
+		goals = append(goals, goal)
+	}
+	return a.restoreAgenda(goals, snapshot.ActiveGoal)
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"errors"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"sync"
+	"testing"
+	"time"
+)
+
+// brokenInstantiator fails to instantiate the Domain
+type brokenInstantiator struct{}
+
+func (brokenInstantiator) Instantiate(domain *Domain, agent *Agent) error {
+	return errors.New("task Patrol refers to the missing method Wander")
+}
+
+func TestReloadRejectsADomainThatDoesNotInstantiate(t *testing.T) {
+	engine, walk := patrolEngine(t)
+	domain := engine.Domain
+	agent, err := engine.Agent("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.Reload(&Domain{Instantiator: brokenInstantiator{}})
+	if err == nil {
+		t.Fatal("expected the broken domain to be rejected")
+	}
+	if engine.Domain != domain {
+		t.Fatal("expected the engine to keep its domain")
+	}
+	current, err := engine.Agent("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != agent || walk.Status() != gohtn.Running {
+		t.Fatal("expected the agent to carry on untouched")
+	}
+}
+
+func TestReloadCarriesOverTheStatusOfTasks(t *testing.T) {
+	engine, _ := patrolEngine(t)
+	walk := primitive("Walk", gohtn.Running)
+	patrol := compound("Patrol", walk)
+	err := engine.Reload(&Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+		return []gohtn.Task{patrol, walk}
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walk.Status() != gohtn.Running {
+		t.Fatalf("expected the reloaded walk to keep running, got %s", walk.Status())
+	}
+	goals, err := engine.Goals("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 1 || goals[0].Name != "patrol" {
+		t.Fatalf("expected the patrol goal to be kept, got %v", goals)
+	}
+}
+
+// gatedInstantiator instantiates the tasks built by the function, holding its first instantiation until released
+type gatedInstantiator struct {
+	testInstantiator
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (i *gatedInstantiator) Instantiate(domain *Domain, agent *Agent) error {
+	i.once.Do(func() {
+		close(i.entered)
+		<-i.release
+	})
+	return i.testInstantiator.Instantiate(domain, agent)
+}
+
+func TestAnAgentAddedDuringAReloadIsBuiltFromTheNewDomain(t *testing.T) {
+	engine, _ := patrolEngine(t)
+	reloaded := &gatedInstantiator{
+		testInstantiator: testInstantiator{tasks: func() []gohtn.Task {
+			walk := primitive("Walk", gohtn.Pending)
+			return []gohtn.Task{compound("Patrol", walk), walk, primitive("Chat", gohtn.Succeeded)}
+		}},
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	reloadDone := make(chan error, 1)
+	go func() {
+		reloadDone <- engine.Reload(&Domain{Instantiator: reloaded})
+	}()
+	<-reloaded.entered
+	added := make(chan *Agent, 1)
+	go func() {
+		agent, err := engine.AddAgent("Guard", newState())
+		if err != nil {
+			t.Error(err)
+		}
+		added <- agent
+	}()
+	// give the guard the time to reach the engine while the reload is still instantiating
+	time.Sleep(10 * time.Millisecond)
+	close(reloaded.release)
+	err := <-reloadDone
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard := <-added
+	if guard == nil {
+		t.FailNow()
+	}
+	if _, ok := guard.Tasks["Chat"]; !ok {
+		t.Fatal("expected the guard to be built from the reloaded domain")
+	}
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"github.com/cory-johannsen/gohtn/logging"
+	"time"
+)
+
+// DefaultTickRate is the time between the starts of two ticks when the Engine does not specify one
+const DefaultTickRate = time.Second
+
+// AgentResult is what one Agent did during a tick: the plan it built, the tasks it executed and the status execution
+// stopped with.  Err holds the error planning or execution stopped with, if any.
+type AgentResult struct {
+	Agent     string
+	Plan      *gohtn.Plan
+	Executed  []gohtn.Task
+	Abandoned []*gohtn.Invalidation
+	Status    gohtn.TaskStatus
+	Err       error
+}
+
+// Idle reports whether the Agent found nothing left to do
+func (r *AgentResult) Idle() bool {
+	return r.Err == nil && r.Plan != nil && len(r.Plan.Tasks) == 0
+}
+
+// Unexpected reports whether the Agent stopped with an error other than a plan that could not be built, was
+// invalidated by the world or was rolled back, which are retried on the next tick
+func (r *AgentResult) Unexpected() bool {
+	if r.Err == nil {
+		return false
+	}
+	var planningError *gohtn.PlanningError
+	var invalidated *gohtn.PlanInvalidatedError
+	var rollbackError *gohtn.RollbackError
+	return !errors.As(r.Err, &planningError) && !errors.As(r.Err, &invalidated) && !errors.As(r.Err, &rollbackError) &&
+		!errors.Is(r.Err, context.Canceled)
+}
+
+// TickResult is the outcome of one tick of the Engine, with the result of each Agent in name order
+type TickResult struct {
+	Tick   int64
+	Agents []*AgentResult
+}
+
+// Idle reports whether every Agent found nothing left to do
+func (r *TickResult) Idle() bool {
+	for _, result := range r.Agents {
+		if !result.Idle() {
+			return false
+		}
+	}
+	return true
+}
+
+// Err returns the first unexpected error an Agent stopped with
+func (r *TickResult) Err() error {
+	for _, result := range r.Agents {
+		if result.Unexpected() {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// StopCondition ends Run once it holds for the result of a tick
+type StopCondition func(result *TickResult) bool
+
+// WhenIdle stops once every Agent has nothing left to do
+func WhenIdle() StopCondition {
+	return func(result *TickResult) bool {
+		return result.Idle()
+	}
+}
+
+// AfterTicks stops once the Engine has run the given number of ticks
+func AfterTicks(ticks int64) StopCondition {
+	return func(result *TickResult) bool {
+		return result.Tick+1 >= ticks
+	}
+}
+
+// OnError stops once an Agent stops with an unexpected error, see AgentResult.Unexpected
+func OnError() StopCondition {
+	return func(result *TickResult) bool {
+		return result.Err() != nil
+	}
+}
+
+// Tick runs one cycle of every Agent: reset policies are applied, a plan is built and executed.  Agents take their
+// turn in name order, so a tick is reproducible.  Tick does not wait for anything but the actions it runs, which makes
+// it suitable to call from the frame loop of a host game.  Ticks are numbered from 0 and run one at a time.
+func (e *Engine) Tick(ctx context.Context) *TickResult {
+	e.tickMutex.Lock()
+	defer e.tickMutex.Unlock()
+	result := &TickResult{Tick: e.tick}
+	e.tick++
+	for _, agent := range e.Agents() {
+		result.Agents = append(result.Agents, agent.tick(ctx, result.Tick))
+	}
+	return result
+}
+
+func (a *Agent) tick(ctx context.Context, tick int64) *AgentResult {
+	result := &AgentResult{Agent: a.Name, Status: gohtn.Pending}
+	logger := a.log().With(logging.Tick(tick))
+	a.ApplyResetPolicies(tick)
+	plan, err := a.Plan()
+	if err != nil {
+		logger.Warn("no plan available", logging.Err(err))
+		result.Status = gohtn.Failed
+		result.Err = err
+		return result
+	}
+	result.Plan = plan
+	if len(plan.Tasks) == 0 {
+		logger.Debug("no tasks to execute")
+		result.Status = gohtn.Succeeded
+		return result
+	}
+	execution, err := a.Executor.Execute(ctx, plan, a.State)
+	result.Plan = execution.Plan
+	result.Executed = execution.Executed
+	result.Abandoned = execution.Abandoned
+	result.Status = execution.Status
+	result.Err = err
+	if err != nil {
+		logger.Warn("plan execution stopped", logging.Err(err))
+	}
+	return result
+}
+
+func (e *Engine) tickRate() time.Duration {
+	if e.TickRate > 0 {
+		return e.TickRate
+	}
+	return DefaultTickRate
+}
+
+// Run ticks the Engine every TickRate on its Clock until one of the stop conditions holds or the context is done, and
+// returns the result of the last tick
+func (e *Engine) Run(ctx context.Context, stop ...StopCondition) (*TickResult, error) {
+	c := clock.OrReal(e.Clock)
+	next := c.Now()
+	for {
+		result := e.Tick(ctx)
+		if e.AfterTick != nil {
+			e.AfterTick(result)
+		}
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		for _, condition := range stop {
+			if condition(result) {
+				return result, nil
+			}
+		}
+		next = next.Add(e.tickRate())
+		if now := c.Now(); next.Before(now) {
+			next = now
+		}
+		err := clock.Sleep(ctx, c, next.Sub(c.Now()))
+		if err != nil {
+			return result, err
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// walking returns a task that runs for the number of ticks before it succeeds
+func walking(name string, ticks int) *gohtn.PrimitiveTask {
+	runs := 0
+	return &gohtn.PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *gohtn.State) (gohtn.TaskStatus, error) {
+			runs++
+			if runs <= ticks {
+				return gohtn.Running, nil
+			}
+			return gohtn.Succeeded, nil
+		},
+	}
+}
+
+// runEngine returns an Engine on a manual clock whose agents each pursue the goal of running the task built for them
+func runEngine(t *testing.T, task func() gohtn.Task, agents ...string) (*Engine, *clock.Manual) {
+	manual := clock.NewManual(epoch)
+	engine := &Engine{
+		Clock:    manual,
+		TickRate: time.Second,
+		Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+			return []gohtn.Task{task()}
+		}}},
+	}
+	for _, agent := range agents {
+		_, err := engine.AddAgent(agent, newState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = engine.PushGoal(agent, &Goal{Name: "goal", Task: task().Name()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return engine, manual
+}
+
+func TestTickNumbersTheTicksAndRunsTheAgentsInNameOrder(t *testing.T) {
+	engine, _ := runEngine(t, func() gohtn.Task { return walking("Walk", 1) }, "Vendor", "Guard")
+	for tick := int64(0); tick < 2; tick++ {
+		result := engine.Tick(context.Background())
+		if result.Tick != tick {
+			t.Fatalf("expected tick %d, got %d", tick, result.Tick)
+		}
+		if len(result.Agents) != 2 || result.Agents[0].Agent != "Guard" || result.Agents[1].Agent != "Vendor" {
+			t.Fatalf("expected Guard then Vendor, got %v", result.Agents)
+		}
+	}
+}
+
+func TestTickReportsWhatEachAgentDid(t *testing.T) {
+	engine, _ := runEngine(t, func() gohtn.Task { return walking("Walk", 1) }, "Vendor")
+	expected := []gohtn.TaskStatus{gohtn.Running, gohtn.Succeeded}
+	for tick, status := range expected {
+		result := engine.Tick(context.Background())
+		agent := result.Agents[0]
+		if agent.Status != status || len(agent.Executed) != 1 || agent.Executed[0].Name() != "Walk" {
+			t.Fatalf("tick %d: expected the walk to be %s, got %s after %v", tick, status, agent.Status, agent.Executed)
+		}
+		if result.Idle() {
+			t.Fatalf("tick %d: expected the agent to be busy", tick)
+		}
+	}
+	if result := engine.Tick(context.Background()); !result.Idle() {
+		t.Fatalf("expected the agent to be idle once the goal is achieved, got %v", result.Agents[0])
+	}
+}
+
+func TestRunTicksEveryTickRateOnTheClock(t *testing.T) {
+	engine, manual := runEngine(t, func() gohtn.Task { return walking("Walk", 10) }, "Vendor")
+	ticks := make(chan *TickResult, 1)
+	engine.AfterTick = func(result *TickResult) {
+		ticks <- result
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.Run(context.Background(), AfterTicks(3))
+		done <- err
+	}()
+	for tick := int64(0); tick < 3; tick++ {
+		result := <-ticks
+		if result.Tick != tick {
+			t.Fatalf("expected tick %d, got %d", tick, result.Tick)
+		}
+		if elapsed := manual.Now().Sub(epoch); elapsed != time.Duration(tick)*time.Second {
+			t.Fatalf("expected tick %d to run after %s, got %s", tick, time.Duration(tick)*time.Second, elapsed)
+		}
+		manual.Advance(time.Second)
+	}
+	err := <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// advancing advances the clock by the tick rate of the Engine after every tick, so Run does not wait
+func advancing(engine *Engine, manual *clock.Manual) {
+	engine.AfterTick = func(result *TickResult) {
+		manual.Advance(engine.TickRate)
+	}
+}
+
+func TestRunStopsAfterTicks(t *testing.T) {
+	engine, manual := runEngine(t, func() gohtn.Task { return walking("Walk", 10) }, "Vendor")
+	advancing(engine, manual)
+	result, err := engine.Run(context.Background(), AfterTicks(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Tick != 3 {
+		t.Fatalf("expected Run to stop after the fourth tick, got tick %d", result.Tick)
+	}
+}
+
+func TestRunStopsWhenIdle(t *testing.T) {
+	engine, manual := runEngine(t, func() gohtn.Task { return walking("Walk", 2) }, "Vendor", "Guard")
+	advancing(engine, manual)
+	result, err := engine.Run(context.Background(), WhenIdle(), AfterTicks(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Idle() || result.Tick != 3 {
+		t.Fatalf("expected Run to stop once both walks are over at tick 3, got tick %d", result.Tick)
+	}
+}
+
+func TestRunStopsOnAnUnexpectedError(t *testing.T) {
+	broken := errors.New("broken")
+	engine, manual := runEngine(t, func() gohtn.Task {
+		return &gohtn.PrimitiveTask{
+			TaskName: "Break",
+			Action: func(ctx context.Context, state *gohtn.State) (gohtn.TaskStatus, error) {
+				return gohtn.Failed, broken
+			},
+		}
+	}, "Vendor")
+	advancing(engine, manual)
+	result, err := engine.Run(context.Background(), OnError(), AfterTicks(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Tick != 0 || !errors.Is(result.Err(), broken) {
+		t.Fatalf("expected Run to stop on the error of the first tick, got %v at tick %d", result.Err(), result.Tick)
+	}
+}
+
+func TestOnErrorIgnoresTheErrorsRetriedOnTheNextTick(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{err: &gohtn.PlanningError{}, expected: false},
+		{err: &gohtn.PlanInvalidatedError{Invalidation: &gohtn.Invalidation{}}, expected: false},
+		{err: &gohtn.RollbackError{Err: errors.New("broken")}, expected: false},
+		{err: context.Canceled, expected: false},
+		{err: errors.New("broken"), expected: true},
+	}
+	for _, test := range tests {
+		result := &TickResult{Agents: []*AgentResult{{Agent: "Vendor", Err: test.err}}}
+		if OnError()(result) != test.expected {
+			t.Errorf("expected OnError to be %t for %T", test.expected, test.err)
+		}
+	}
+}
+
+func TestRunStopsWhenTheContextIsDone(t *testing.T) {
+	engine, _ := runEngine(t, func() gohtn.Task { return walking("Walk", 10) }, "Vendor")
+	ctx, cancel := context.WithCancel(context.Background())
+	engine.AfterTick = func(result *TickResult) {
+		cancel()
+	}
+	result, err := engine.Run(ctx, AfterTicks(10))
+	if !errors.Is(err, context.Canceled) || result.Tick != 0 {
+		t.Fatalf("expected Run to stop with the context after the first tick, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"io"
+	"sort"
+	"time"
+)
+
+// SnapshotVersion is the version of the snapshot document written by Snapshot.  Restore refuses other versions.
+const SnapshotVersion = 1
+
+// Snapshot is a versioned document of the runtime state of an Engine, its actors, sensors and agents
+type Snapshot struct {
+	Version int                       `json:"version"`
+	Tick    int64                     `json:"tick"`
+	Time    time.Time                 `json:"time"`
+	Actors  map[string]*ActorSnapshot `json:"actors,omitempty"`
+	Sensors map[string]float64        `json:"sensors,omitempty"`
+	Elapsed map[string]time.Duration  `json:"elapsed,omitempty"`
+	Agents  []*AgentSnapshot          `json:"agents"`
+}
+
+// ActorSnapshot records where an actor is, and the customers of a vendor
+type ActorSnapshot struct {
+	Location  *actor.Point `json:"location,omitempty"`
+	Customers []string     `json:"customers,omitempty"`
+}
+
+// AgentSnapshot records the state of an Agent: its tasks, the facts effects have set on its State, its agenda, the
+// goal driving it and its random source.  Plans are not recorded, since the Agent plans again every tick; the status
+// of its tasks and the methods its compound tasks committed to carry its position in the plan.
+type AgentSnapshot struct {
+	Name       string                `json:"name"`
+	Tasks      []*gohtn.TaskSnapshot `json:"tasks"`
+	Facts      map[string]float64    `json:"facts,omitempty"`
+	Goals      []*GoalSnapshot       `json:"goals,omitempty"`
+	ActiveGoal string                `json:"activeGoal,omitempty"`
+	Random     *RandomSnapshot       `json:"random,omitempty"`
+}
+
+// RandomSnapshot records the random source of an Agent as its seed and the number of values drawn from it
+type RandomSnapshot struct {
+	Seed  int64 `json:"seed"`
+	Draws int64 `json:"draws"`
+}
+
+// GoalSnapshot records a goal on the agenda of an Agent
+type GoalSnapshot struct {
+	Name       string `json:"name"`
+	Task       string `json:"task"`
+	Priority   int    `json:"priority,omitempty"`
+	Persistent bool   `json:"persistent,omitempty"`
+	Preempted  bool   `json:"preempted,omitempty"`
+}
+
+// Snapshot records the runtime state of the Engine.  It should be taken between ticks.
+func (e *Engine) Snapshot() *Snapshot {
+	e.tickMutex.Lock()
+	defer e.tickMutex.Unlock()
+	snapshot := &Snapshot{
+		Version: SnapshotVersion,
+		Tick:    e.tick,
+		Time:    clock.OrReal(e.Clock).Now(),
+		Actors:  make(map[string]*ActorSnapshot),
+		Sensors: make(map[string]float64),
+		Elapsed: make(map[string]time.Duration),
+		Agents:  make([]*AgentSnapshot, 0),
+	}
+	for name, a := range e.Actors {
+		actorSnapshot := &ActorSnapshot{}
+		if a.Location() != nil {
+			location := *a.Location()
+			actorSnapshot.Location = &location
+		}
+		if vendor, ok := a.(*actor.Vendor); ok {
+			for customer := range vendor.Customers {
+				actorSnapshot.Customers = append(actorSnapshot.Customers, customer)
+			}
+			sort.Strings(actorSnapshot.Customers)
+		}
+		snapshot.Actors[name] = actorSnapshot
+	}
+	for name, sensor := range e.Sensors {
+		if simple, ok := sensor.(*gohtn.SimpleSensor); ok {
+			snapshot.Sensors[name] = simple.Value
+		}
+		if tickSensor := asTickSensor(sensor); tickSensor != nil {
+			snapshot.Elapsed[name] = clock.OrReal(tickSensor.Clock).Now().Sub(tickSensor.StartedAt)
+		}
+	}
+	for _, agent := range e.Agents() {
+		snapshot.Agents = append(snapshot.Agents, agent.snapshot())
+	}
+	return snapshot
+}
+
+func (a *Agent) snapshot() *AgentSnapshot {
+	snapshot := &AgentSnapshot{
+		Name:  a.Name,
+		Tasks: make([]*gohtn.TaskSnapshot, 0, len(a.Tasks)),
+		Facts: gohtn.Facts(a.State),
+	}
+	names := make([]string, 0, len(a.Tasks))
+	for name := range a.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		snapshot.Tasks = append(snapshot.Tasks, gohtn.SnapshotTask(a.Tasks[name]))
+	}
+	for _, goal := range a.Agenda.Goals() {
+		snapshot.Goals = append(snapshot.Goals, &GoalSnapshot{
+			Name:       goal.Name,
+			Task:       goal.Task,
+			Priority:   goal.Priority,
+			Persistent: goal.Persistent,
+			Preempted:  goal.preempted,
+		})
+	}
+	if a.active != nil {
+		snapshot.ActiveGoal = a.active.Name
+	}
+	if a.source != nil {
+		snapshot.Random = &RandomSnapshot{Seed: a.source.seed, Draws: a.source.draws}
+	}
+	return snapshot
+}
+
+// Restore brings the Engine back to the snapshot.  Agents that are not running yet are added with the State returned
+// by newState.  The clock of the Engine is left alone.
+func (e *Engine) Restore(snapshot *Snapshot, newState func(agent string) (*gohtn.State, error)) error {
+	if snapshot.Version != SnapshotVersion {
+		return fmt.Errorf("snapshot version %d is not supported, expected version %d", snapshot.Version, SnapshotVersion)
+	}
+	for name, actorSnapshot := range snapshot.Actors {
+		err := e.restoreActor(name, actorSnapshot)
+		if err != nil {
+			return err
+		}
+	}
+	for name, value := range snapshot.Sensors {
+		simple, ok := e.Sensors[name].(*gohtn.SimpleSensor)
+		if !ok {
+			return fmt.Errorf("snapshot sensor %s is not a simple sensor of the engine", name)
+		}
+		simple.Value = value
+	}
+	// tick sensors carry on from the time they had counted
+	for name, elapsed := range snapshot.Elapsed {
+		tickSensor := asTickSensor(e.Sensors[name])
+		if tickSensor == nil {
+			return fmt.Errorf("snapshot sensor %s is not a tick sensor of the engine", name)
+		}
+		tickSensor.StartedAt = clock.OrReal(tickSensor.Clock).Now().Add(-elapsed)
+	}
+	for _, agentSnapshot := range snapshot.Agents {
+		agent, err := e.Agent(agentSnapshot.Name)
+		if err != nil {
+			if newState == nil {
+				return err
+			}
+			state, err := newState(agentSnapshot.Name)
+			if err != nil {
+				return fmt.Errorf("agent %s: %w", agentSnapshot.Name, err)
+			}
+			agent, err = e.AddAgent(agentSnapshot.Name, state)
+			if err != nil {
+				return err
+			}
+		}
+		err = agent.restore(agentSnapshot)
+		if err != nil {
+			return fmt.Errorf("agent %s: %w", agentSnapshot.Name, err)
+		}
+	}
+	e.tickMutex.Lock()
+	defer e.tickMutex.Unlock()
+	e.tick = snapshot.Tick
+	return nil
+}
+
+// asTickSensor returns the TickSensor of a time-based sensor, or nil for other sensors
+func asTickSensor(sensor any) *gohtn.TickSensor {
+	switch s := sensor.(type) {
+	case *gohtn.TickSensor:
+		return s
+	case *gohtn.HourOfDaySensor:
+		return &s.TickSensor
+	}
+	return nil
+}
+
+func (e *Engine) restoreActor(name string, snapshot *ActorSnapshot) error {
+	a, ok := e.Actors[name]
+	if !ok {
+		return fmt.Errorf("snapshot actor %s is not an actor of the engine", name)
+	}
+	if snapshot.Location != nil && a.Location() != nil {
+		*a.Location() = *snapshot.Location
+	}
+	vendor, ok := a.(*actor.Vendor)
+	if !ok {
+		return nil
+	}
+	vendor.Customers = make(actor.Actors)
+	for _, customerName := range snapshot.Customers {
+		customer, ok := e.Actors[customerName]
+		if !ok {
+			return fmt.Errorf("vendor %s customer %s is not an actor of the engine", name, customerName)
+		}
+		vendor.Customers[customerName] = customer
+	}
+	return nil
+}
+
+func (a *Agent) restore(snapshot *AgentSnapshot) error {
+	for _, taskSnapshot := range snapshot.Tasks {
+		task, err := a.resolve(taskSnapshot.Name)
+		if err != nil {
+			return err
+		}
+		err = gohtn.RestoreTask(task, taskSnapshot, a.State)
+		if err != nil {
+			return err
+		}
+	}
+	err := gohtn.RestoreFacts(a.State, snapshot.Facts)
+	if err != nil {
+		return err
+	}
+	if snapshot.Random != nil && a.source != nil {
+		a.source.restore(snapshot.Random.Seed, snapshot.Random.Draws)
+	}
+	return a.restoreAgenda(snapshot.Goals, snapshot.ActiveGoal)
+}
+
+// restoreAgenda replaces the Agenda with the goals, making the named one active
+func (a *Agent) restoreAgenda(goals []*GoalSnapshot, activeGoal string) error {
+	var err error
+	a.Agenda = &Agenda{}
+	// the roots of the active goal, or of the task graph, are cancelled once another goal takes over
+	a.active = nil
+	a.activeRoots, err = a.Graph.Network()
+	if err != nil {
+		return err
+	}
+	for _, goalSnapshot := range goals {
+		goal := &Goal{
+			Name:       goalSnapshot.Name,
+			Task:       goalSnapshot.Task,
+			Priority:   goalSnapshot.Priority,
+			Persistent: goalSnapshot.Persistent,
+			preempted:  goalSnapshot.Preempted,
+		}
+		err := a.Agenda.Push(goal)
+		if err != nil {
+			return err
+		}
+		if goal.Name == activeGoal {
+			root, err := a.resolve(goal.Task)
+			if err != nil {
+				return err
+			}
+			a.active = goal
+			a.activeRoots = []gohtn.Task{root}
+		}
+	}
+	return nil
+}
+
+// WriteSnapshot writes the snapshot as an indented JSON document
+func WriteSnapshot(w io.Writer, snapshot *Snapshot) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+// ReadSnapshot reads a JSON snapshot document, refusing versions other than SnapshotVersion
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	snapshot := &Snapshot{}
+	err := json.NewDecoder(r).Decode(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot version %d is not supported, expected version %d", snapshot.Version, SnapshotVersion)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"math/rand"
+	"testing"
+)
+
+// patrolEngine returns an Engine whose agent Vendor is walking a patrol, along with the walk
+func patrolEngine(t *testing.T) (*Engine, *gohtn.PrimitiveTask) {
+	walk := primitive("Walk", gohtn.Running)
+	patrol := compound("Patrol", walk)
+	engine := &Engine{
+		Random: rand.NewSource(1),
+		Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+			return []gohtn.Task{patrol, walk}
+		}}},
+	}
+	_, err := engine.AddAgent("Vendor", newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = engine.PushGoal("Vendor", &Goal{Name: "patrol", Task: "Patrol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Tick(context.Background())
+	return engine, walk
+}
+
+func setFact(t *testing.T, state *gohtn.State, property string, value float64) {
+	err := (&gohtn.Effect{Operation: gohtn.SetProperty, Property: property, Value: value}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// roundTrip writes the snapshot as JSON and reads it back
+func roundTrip(t *testing.T, snapshot *Snapshot) *Snapshot {
+	var buffer bytes.Buffer
+	err := WriteSnapshot(&buffer, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSnapshot(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return read
+}
+
+func TestRestoreReturnsAnAgentToItsSnapshot(t *testing.T) {
+	engine, walk := patrolEngine(t)
+	agent, err := engine.Agent("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFact(t, agent.State, "Tired", 1)
+	agent.Random.Float64()
+	snapshot := roundTrip(t, engine.Snapshot())
+	next := agent.Random.Float64()
+
+	setFact(t, agent.State, "Tired", 3)
+	setFact(t, agent.State, "Hungry", 1)
+	walk.Cancel()
+	err = engine.Restore(snapshot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	facts := gohtn.Facts(agent.State)
+	if len(facts) != 1 || facts["Tired"] != 1 {
+		t.Fatalf("expected only the fact of the snapshot, got %v", facts)
+	}
+	if walk.Status() != gohtn.Running {
+		t.Fatalf("expected the walk to be running again, got %s", walk.Status())
+	}
+	if agent.Random.Float64() != next {
+		t.Fatal("expected the random source to draw again what it drew after the snapshot")
+	}
+	if agent.active == nil || agent.active.Name != "patrol" {
+		t.Fatalf("expected the patrol goal to be active, got %v", agent.active)
+	}
+}
+
+func TestRestoreAddsTheAgentsOfTheSnapshot(t *testing.T) {
+	engine, _ := patrolEngine(t)
+	agent, err := engine.Agent("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFact(t, agent.State, "Tired", 1)
+	snapshot := roundTrip(t, engine.Snapshot())
+	next := agent.Random.Float64()
+
+	walk := primitive("Walk", gohtn.Pending)
+	patrol := compound("Patrol", walk)
+	restored := &Engine{Domain: &Domain{Instantiator: &testInstantiator{tasks: func() []gohtn.Task {
+		return []gohtn.Task{patrol, walk}
+	}}}}
+	err = restored.Restore(snapshot, func(agent string) (*gohtn.State, error) {
+		return newState(), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent, err = restored.Agent("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walk.Status() != gohtn.Running {
+		t.Fatalf("expected the walk to be running, got %s", walk.Status())
+	}
+	if facts := gohtn.Facts(agent.State); facts["Tired"] != 1 {
+		t.Fatalf("expected the fact to be restored, got %v", facts)
+	}
+	if agent.Random.Float64() != next {
+		t.Fatal("expected the random source to carry on from the snapshot")
+	}
+	goals, err := restored.Goals("Vendor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goals) != 1 || goals[0].Name != "patrol" {
+		t.Fatalf("expected the patrol goal, got %v", goals)
+	}
+}
@@ -0,0 +1,267 @@
+package gohtn
+
+import (
+	"fmt"
+	"github.com/cory-johannsen/gohtn/actor"
+	"sort"
+	"strings"
+)
+
+// Bindings maps the variables of a parameterized task or method, such as ?customer, to the values bound to them
+type Bindings map[string]any
+
+// With returns a copy of the Bindings with the variable bound to the value
+func (b Bindings) With(variable string, value any) Bindings {
+	bindings := make(Bindings, len(b)+1)
+	for name, bound := range b {
+		bindings[name] = bound
+	}
+	bindings[variable] = value
+	return bindings
+}
+
+func (b Bindings) String() string {
+	bindings := make([]string, 0)
+	for variable, value := range b {
+		bindings = append(bindings, fmt.Sprintf("%s=%s", variable, argumentName(value)))
+	}
+	sort.Strings(bindings)
+	return strings.Join(bindings, ",")
+}
+
+// IsVariable reports whether the argument is a variable rather than a literal
+func IsVariable(argument string) bool {
+	return strings.HasPrefix(argument, "?")
+}
+
+// ParseCall splits a reference such as Greet(?customer) into the name and the arguments.  A reference without
+// parentheses has no arguments.
+func ParseCall(call string) (string, []string, error) {
+	open := strings.Index(call, "(")
+	if open < 0 {
+		return call, nil, nil
+	}
+	if !strings.HasSuffix(call, ")") {
+		return "", nil, fmt.Errorf("call %s is missing a closing parenthesis", call)
+	}
+	name := strings.TrimSpace(call[:open])
+	arguments := make([]string, 0)
+	for _, argument := range strings.Split(call[open+1:len(call)-1], ",") {
+		argument = strings.TrimSpace(argument)
+		if len(argument) == 0 {
+			continue
+		}
+		if !IsVariable(argument) {
+			return "", nil, fmt.Errorf("call %s argument %s is not a variable", call, argument)
+		}
+		arguments = append(arguments, argument)
+	}
+	return name, arguments, nil
+}
+
+// argumentName names a bound value, using the name of an actor
+func argumentName(value any) string {
+	if a, ok := value.(actor.Actor); ok {
+		return a.Name()
+	}
+	return fmt.Sprint(value)
+}
+
+// Parameterized is implemented by tasks that declare parameters.  Ground returns the instance of the task bound to
+// the arguments, creating it the first time those arguments are seen so its status carries across plans.  Evict drops
+// the instances bound to an actor that is no longer among the actors.
+type Parameterized interface {
+	Task
+	Parameters() []string
+	Ground(arguments []any) (Task, error)
+	Instances() []Task
+	Evict(actors actor.Actors)
+}
+
+// Ground binds the variables of a call to their values and returns the matching instance of the task
+func Ground(task Task, variables []string, bindings Bindings) (Task, error) {
+	if len(variables) == 0 {
+		return task, nil
+	}
+	parameterized, ok := task.(Parameterized)
+	if !ok {
+		return nil, fmt.Errorf("task %s does not take parameters", task.Name())
+	}
+	arguments := make([]any, 0, len(variables))
+	for _, variable := range variables {
+		value, ok := bindings[variable]
+		if !ok {
+			return nil, fmt.Errorf("task %s variable %s is not bound", task.Name(), variable)
+		}
+		arguments = append(arguments, value)
+	}
+	return parameterized.Ground(arguments)
+}
+
+// Instances returns the grounded instances of a parameterized task, or the task itself when it has no parameters
+func Instances(task Task) []Task {
+	parameterized, ok := task.(Parameterized)
+	if !ok || len(parameterized.Parameters()) == 0 {
+		return []Task{task}
+	}
+	return parameterized.Instances()
+}
+
+// Evict drops the grounded instances of a parameterized task that are bound to an actor no longer among the actors,
+// cancelling those still running.  An actor that comes back is bound to a new instance, starting from Pending.
+func Evict(task Task, actors actor.Actors) {
+	if parameterized, ok := task.(Parameterized); ok && len(parameterized.Parameters()) > 0 {
+		parameterized.Evict(actors)
+	}
+}
+
+// instances holds the grounded instances of a parameterized task and their arguments, keyed by their ground name
+type instances struct {
+	tasks     map[string]Task
+	arguments map[string][]any
+	names     []string
+}
+
+// groundName names the instance of a task bound to the arguments, e.g. Greet(Player)
+func groundName(name string, arguments []any) string {
+	names := make([]string, 0, len(arguments))
+	for _, argument := range arguments {
+		names = append(names, argumentName(argument))
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(names, ","))
+}
+
+// bind zips the parameters with the arguments
+func bind(name string, parameters []string, arguments []any) (Bindings, error) {
+	if len(arguments) != len(parameters) {
+		return nil, fmt.Errorf("task %s takes %d arguments, got %d", name, len(parameters), len(arguments))
+	}
+	bindings := make(Bindings, len(parameters))
+	for i, parameter := range parameters {
+		bindings[parameter] = arguments[i]
+	}
+	return bindings, nil
+}
+
+func (i *instances) get(name string, arguments []any, create func() Task) Task {
+	if i.tasks == nil {
+		i.tasks = make(map[string]Task)
+		i.arguments = make(map[string][]any)
+	}
+	task, ok := i.tasks[name]
+	if !ok {
+		task = create()
+		i.tasks[name] = task
+		i.arguments[name] = arguments
+		i.names = append(i.names, name)
+	}
+	return task
+}
+
+// evict drops the instances bound to an actor missing from the actors, cancelling them
+func (i *instances) evict(actors actor.Actors) {
+	names := make([]string, 0, len(i.names))
+	for _, name := range i.names {
+		if present(i.arguments[name], actors) {
+			names = append(names, name)
+			continue
+		}
+		i.tasks[name].Cancel()
+		delete(i.tasks, name)
+		delete(i.arguments, name)
+	}
+	i.names = names
+}
+
+// present reports whether every actor among the arguments is still among the actors
+func present(arguments []any, actors actor.Actors) bool {
+	for _, argument := range arguments {
+		if a, ok := argument.(actor.Actor); ok {
+			if _, ok := actors[a.Name()]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (i *instances) all() []Task {
+	tasks := make([]Task, 0, len(i.names))
+	for _, name := range i.names {
+		tasks = append(tasks, i.tasks[name])
+	}
+	return tasks
+}
+
+// ActorCondition is a condition on a single actor.  Referenced with a variable argument, e.g. IsNPC(?customer), it
+// becomes a VariableCondition that binds the variable to the actors that satisfy it.
+type ActorCondition interface {
+	IsMetBy(a actor.Actor, state *State) bool
+	String() string
+}
+
+type ActorEvaluator func(a actor.Actor, state *State) bool
+
+// FuncActorCondition is an ActorCondition evaluated by a function
+type FuncActorCondition struct {
+	Name      string
+	Evaluator ActorEvaluator
+}
+
+func (f *FuncActorCondition) IsMetBy(a actor.Actor, state *State) bool {
+	return f.Evaluator(a, state)
+}
+
+func (f *FuncActorCondition) String() string {
+	return fmt.Sprintf("FuncActorCondition: %s", f.Name)
+}
+
+// Binder is implemented by conditions that bind variables.  Bind returns every extension of the State Bindings under
+// which the condition is met, so an empty result means the condition can not be met.
+type Binder interface {
+	Condition
+	Bind(state *State) []Bindings
+}
+
+// VariableCondition applies an ActorCondition to the actor bound to Variable.  When the variable is not bound yet, it
+// is bound to each actor of the State that satisfies the condition, in name order.
+type VariableCondition struct {
+	Variable  string
+	Condition ActorCondition
+}
+
+func (v *VariableCondition) IsMet(state *State) bool {
+	a, err := state.BoundActor(v.Variable)
+	if err != nil {
+		return false
+	}
+	return v.Condition.IsMetBy(a, state)
+}
+
+func (v *VariableCondition) Bind(state *State) []Bindings {
+	if _, ok := state.Bindings[v.Variable]; ok {
+		if isMet(v, state) {
+			return []Bindings{state.Bindings}
+		}
+		return nil
+	}
+	names := make([]string, 0, len(state.Actors))
+	for name := range state.Actors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bindings := make([]Bindings, 0)
+	for _, name := range names {
+		a := state.Actors[name]
+		if v.Condition.IsMetBy(a, state) {
+			bindings = append(bindings, state.Bindings.With(v.Variable, a))
+		}
+	}
+	return bindings
+}
+
+func (v *VariableCondition) String() string {
+	return fmt.Sprintf("%s(%s)", v.Condition.String(), v.Variable)
+}
+
+var _ Binder = &VariableCondition{}
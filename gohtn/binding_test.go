@@ -0,0 +1,161 @@
+package gohtn
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/actor"
+	"testing"
+)
+
+// market returns a State observing a player and two NPCs
+func market() *State {
+	state := newState()
+	state.Actors = actor.Actors{
+		"Player": &actor.Player{ActorName: "Player"},
+		"Guard":  &actor.NPC{ActorName: "Guard"},
+		"Vendor": &actor.NPC{ActorName: "Vendor"},
+	}
+	return state
+}
+
+// isNPC is met by the actors that are not players
+var isNPC = &FuncActorCondition{Name: "IsNPC", Evaluator: func(a actor.Actor, state *State) bool {
+	return a.IsNPC()
+}}
+
+// greeting returns a task greeting the actor bound to ?customer, finishing with the status
+func greeting(status TaskStatus) *PrimitiveTask {
+	task := primitive("Greet", status)
+	task.TaskParameters = []string{"?customer"}
+	return task
+}
+
+func TestParseCall(t *testing.T) {
+	tests := []struct {
+		call      string
+		name      string
+		arguments []string
+		fails     bool
+	}{
+		{call: "Greet", name: "Greet"},
+		{call: "Greet()", name: "Greet", arguments: []string{}},
+		{call: "Greet(?customer)", name: "Greet", arguments: []string{"?customer"}},
+		{call: "Trade( ?buyer, ?seller )", name: "Trade", arguments: []string{"?buyer", "?seller"}},
+		{call: "Greet(?customer", fails: true},
+		{call: "Greet(Player)", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.call, func(t *testing.T) {
+			name, arguments, err := ParseCall(test.call)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected %s to be rejected", test.call)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != test.name || fmt.Sprint(arguments) != fmt.Sprint(test.arguments) {
+				t.Fatalf("expected %s%v, got %s%v", test.name, test.arguments, name, arguments)
+			}
+		})
+	}
+}
+
+func TestVariableConditionBindsEachActorMeetingTheCondition(t *testing.T) {
+	state := market()
+	condition := &VariableCondition{Variable: "?customer", Condition: isNPC}
+	bindings := condition.Bind(state)
+	if len(bindings) != 2 || fmt.Sprint(bindings) != "[?customer=Guard ?customer=Vendor]" {
+		t.Fatalf("expected the NPCs to be bound in name order, got %v", bindings)
+	}
+	if len(state.Bindings) != 0 {
+		t.Fatalf("expected the bindings of the State to be left alone, got %v", state.Bindings)
+	}
+}
+
+func TestVariableConditionChecksAnActorAlreadyBound(t *testing.T) {
+	state := market()
+	condition := &VariableCondition{Variable: "?customer", Condition: isNPC}
+	player := state.Bind(Bindings{"?customer": state.Actors["Player"]})
+	if condition.IsMet(player) || len(condition.Bind(player)) != 0 {
+		t.Fatal("expected the bound player not to meet the condition")
+	}
+	guard := state.Bind(Bindings{"?customer": state.Actors["Guard"]})
+	if bindings := condition.Bind(guard); !condition.IsMet(guard) || len(bindings) != 1 {
+		t.Fatalf("expected the bound guard to keep its binding, got %v", bindings)
+	}
+	if condition.IsMet(state) {
+		t.Fatal("expected the condition not to be met without a binding")
+	}
+}
+
+func TestGroundReturnsOneInstancePerArguments(t *testing.T) {
+	state := market()
+	greet := greeting(Succeeded)
+	player, err := Ground(greet, []string{"?customer"}, Bindings{"?customer": state.Actors["Player"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Ground(greet, []string{"?customer"}, Bindings{"?customer": state.Actors["Player"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard, err := Ground(greet, []string{"?customer"}, Bindings{"?customer": state.Actors["Guard"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if player.Name() != "Greet(Player)" || again != player || guard == player {
+		t.Fatalf("expected one instance per customer, got %s, %s and %s", player.Name(), again.Name(), guard.Name())
+	}
+	if instances := Instances(greet); len(instances) != 2 {
+		t.Fatalf("expected two instances, got %v", names(instances))
+	}
+	_, err = Ground(greet, []string{"?customer"}, Bindings{})
+	if err == nil {
+		t.Fatal("expected an unbound variable to be rejected")
+	}
+	_, err = Ground(primitive("Wave", Succeeded), []string{"?customer"}, Bindings{"?customer": state.Actors["Player"]})
+	if err == nil {
+		t.Fatal("expected a task without parameters to reject arguments")
+	}
+}
+
+func TestEvictDropsTheInstancesOfActorsThatLeft(t *testing.T) {
+	state := market()
+	greet := greeting(Running)
+	bindings := Bindings{"?customer": state.Actors["Player"]}
+	player, err := Ground(greet, []string{"?customer"}, bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = player.Execute(context.Background(), state.Bind(bindings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Ground(greet, []string{"?customer"}, Bindings{"?customer": state.Actors["Guard"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Evict(greet, state.Actors)
+	if len(Instances(greet)) != 2 {
+		t.Fatalf("expected the instances of present actors to stay, got %v", names(Instances(greet)))
+	}
+	delete(state.Actors, "Player")
+	Evict(greet, state.Actors)
+	if instances := Instances(greet); len(instances) != 1 || instances[0].Name() != "Greet(Guard)" {
+		t.Fatalf("expected only the guard to keep an instance, got %v", names(instances))
+	}
+	if player.Status() != Cancelled {
+		t.Fatalf("expected the running instance of the player to be cancelled, got %s", player.Status())
+	}
+	returned, err := Ground(greet, []string{"?customer"}, bindings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returned == player || returned.Status() != Pending {
+		t.Fatalf("expected a returning player to get a new instance, got %s", returned.Status())
+	}
+}
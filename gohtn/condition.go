@@ -2,7 +2,7 @@ package gohtn
 
 import (
 	"fmt"
-	"log"
+	"github.com/cory-johannsen/gohtn/logging"
 )
 
 type Condition interface {
@@ -102,11 +102,42 @@ func (c *ComparisonCondition[T]) IsMet(state *State) bool {
 	if err != nil {
 		return false
 	}
-	value := property.(*Property[T]).Value(state)
-	log.Printf("ComparisonCondition comparing %s(%v) %s %v", c.Property, value, c.Comparison, c.Value)
+	var value T
+	if typed, ok := property.(*Property[T]); ok {
+		value = typed.Value(state)
+	} else {
+		// an effect may have created the property with another numeric type
+		value, ok = numberAs[T](state, c.Property)
+		if !ok {
+			state.Log().Error("condition property has the wrong type", logging.F("property", c.Property), logging.Err(fmt.Errorf("expected %T, got %T", typed, property)))
+			return false
+		}
+	}
+	state.Log().Debug("comparing property", logging.F("property", c.Property), logging.F("value", value), logging.F("comparison", c.Comparison), logging.F("expected", c.Value))
 	return c.Comparator(c.Value, value, c.Comparison)
 }
 
+// numberAs converts the numeric value of the property to T, when T is a number type
+func numberAs[T any](state *State, name string) (T, bool) {
+	var value T
+	number, err := state.Number(name)
+	if err != nil {
+		return value, false
+	}
+	var converted any
+	switch any(value).(type) {
+	case float64:
+		converted = number
+	case int64:
+		converted = int64(number)
+	case int:
+		converted = int(number)
+	default:
+		return value, false
+	}
+	return converted.(T), true
+}
+
 func (c *ComparisonCondition[T]) String() string {
 	return fmt.Sprintf("ComparisonCondition: property %s %s value %v", c.Property, c.Comparison, c.Value)
 }
@@ -119,16 +150,14 @@ type PropertyComparisonCondition struct {
 }
 
 func (p *PropertyComparisonCondition) IsMet(state *State) bool {
-	lhsProperty, err := state.Property(p.LHS)
+	lhs, err := state.Number(p.LHS)
 	if err != nil {
 		return false
 	}
-	lhs := lhsProperty.(Property[any]).Value(state).(float64)
-	rhsProperty, err := state.Property(p.RHS)
+	rhs, err := state.Number(p.RHS)
 	if err != nil {
 		return false
 	}
-	rhs := rhsProperty.(Property[any]).Value(state).(float64)
 	switch p.Comparison {
 	case EQ:
 		return lhs == rhs
@@ -166,19 +195,15 @@ type LogicalCondition struct {
 }
 
 func (l *LogicalCondition) IsMet(state *State) bool {
-	lhsProperty, err := state.Property(l.LHSProperty)
+	lhsFloat, err := state.Number(l.LHSProperty)
 	if err != nil {
 		return false
 	}
-	lhs := lhsProperty.(Property[any]).Value(state).(float64) > 0
-	rhsProperty, err := state.Property(l.RHSProperty)
-	rhsFloat := float64(0)
-	if err != nil {
-		if l.Operator == NOT {
-			rhsFloat = rhsProperty.(Property[any]).Value(state).(float64)
-		} else {
-			return false
-		}
+	lhs := lhsFloat > 0
+	// NOT only reads the left hand side
+	rhsFloat, err := state.Number(l.RHSProperty)
+	if err != nil && l.Operator != NOT {
+		return false
 	}
 	rhs := rhsFloat > 0
 
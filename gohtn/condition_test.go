@@ -0,0 +1,53 @@
+package gohtn
+
+import "testing"
+
+func TestComparisonConditionOnAPropertyCreatedByAnEffect(t *testing.T) {
+	state := newState()
+	err := (&Effect{Operation: SetProperty, Property: "CustomersEngaged", Value: 0}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition := &ComparisonCondition[int64]{
+		Comparison: EQ,
+		Value:      0,
+		Property:   "CustomersEngaged",
+		Comparator: Int64Comparator,
+	}
+	if !condition.IsMet(state) {
+		t.Fatal("expected the condition to compare the number the effect set")
+	}
+	err = (&Effect{Operation: IncrementProperty, Property: "CustomersEngaged", Value: 1}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condition.IsMet(state) {
+		t.Fatal("expected the condition not to be met once the number changed")
+	}
+}
+
+func TestComparisonConditionOnANonNumericProperty(t *testing.T) {
+	state := newState()
+	state.Properties["Name"] = &Property[string]{Name: "Name", Value: func(state *State) string {
+		return "Vendor"
+	}}
+	condition := &ComparisonCondition[int]{Comparison: EQ, Value: 0, Property: "Name", Comparator: IntComparator}
+	if condition.IsMet(state) {
+		t.Fatal("expected a condition on a property of another type not to be met")
+	}
+}
+
+func TestPropertyComparisonConditionComparesNumbersOfAnyType(t *testing.T) {
+	state := newState()
+	state.Properties["CustomersInRange"] = &Property[int]{Name: "CustomersInRange", Value: func(state *State) int {
+		return 2
+	}}
+	err := (&Effect{Operation: SetProperty, Property: "CustomersEngaged", Value: 1}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	condition := &PropertyComparisonCondition{Comparison: GT, LHS: "CustomersInRange", RHS: "CustomersEngaged"}
+	if !condition.IsMet(state) {
+		t.Fatal("expected 2 customers in range to be more than 1 engaged")
+	}
+}
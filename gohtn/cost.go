@@ -0,0 +1,63 @@
+package gohtn
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Cost is the price the planner charges for a primitive Task or a Method.  It is the static Value plus, when a
+// Property is named, that Property's numeric value multiplied by Scale.  A Scale of zero is treated as one.  Specs may
+// declare a static cost as a bare number.
+type Cost struct {
+	Value    float64 `json:"value,omitempty"`
+	Property string  `json:"property,omitempty"`
+	Scale    float64 `json:"scale,omitempty"`
+}
+
+func (c *Cost) UnmarshalJSON(data []byte) error {
+	var value float64
+	if json.Unmarshal(data, &value) == nil {
+		*c = Cost{Value: value}
+		return nil
+	}
+	type cost Cost
+	spec := cost{}
+	err := json.Unmarshal(data, &spec)
+	if err != nil {
+		return err
+	}
+	*c = Cost(spec)
+	return nil
+}
+
+// Evaluate resolves the Cost against the State.  Costs must not be negative, since the cheapest plan search prunes
+// any partial plan that already costs as much as the best one found.
+func (c Cost) Evaluate(state *State) (float64, error) {
+	cost := c.Value
+	if len(c.Property) > 0 {
+		value, err := state.Number(c.Property)
+		if err != nil {
+			return 0, err
+		}
+		scale := c.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		cost += value * scale
+	}
+	if cost < 0 {
+		return 0, fmt.Errorf("cost %s evaluated to negative value %f", c.String(), cost)
+	}
+	return cost, nil
+}
+
+func (c Cost) String() string {
+	if len(c.Property) == 0 {
+		return fmt.Sprintf("%v", c.Value)
+	}
+	scale := c.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return fmt.Sprintf("%v + %v * %s", c.Value, scale, c.Property)
+}
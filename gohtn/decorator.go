@@ -0,0 +1,302 @@
+package gohtn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/logging"
+	"time"
+)
+
+type DecoratorType string
+
+const (
+	Repeat   DecoratorType = "repeat"
+	Retry    DecoratorType = "retry"
+	Timeout  DecoratorType = "timeout"
+	Cooldown DecoratorType = "cooldown"
+	Invert   DecoratorType = "invert"
+)
+
+// Decorator wraps a Task with control semantics: Repeat, Retry with backoff, Timeout, Cooldown or Invert.  The planner
+// treats the decorated task as a single step.  Ticks are counted by Advance, and durations are measured on the Clock.
+type Decorator struct {
+	Type        DecoratorType
+	Task        Task
+	Count       int
+	Until       Condition
+	Ticks       int64
+	Duration    time.Duration
+	Clock       clock.Clock
+	TaskStatus  TaskStatus
+	tick        int64
+	runs        int
+	startedTick int64
+	startedAt   time.Time
+	started     bool
+	retryAt     int64
+	finished    bool
+	finishedAt  time.Time
+	finishTick  int64
+	instances   instances
+}
+
+func (d *Decorator) Validate() error {
+	switch d.Type {
+	case Repeat:
+		if d.Count <= 0 && d.Until == nil {
+			return fmt.Errorf("decorator %s requires a positive count or an until condition", d.Type)
+		}
+	case Retry:
+		if d.Count <= 0 {
+			return fmt.Errorf("decorator %s requires a positive count", d.Type)
+		}
+	case Timeout, Cooldown:
+		if d.Ticks <= 0 && d.Duration <= 0 {
+			return fmt.Errorf("decorator %s requires positive ticks or a duration", d.Type)
+		}
+	case Invert:
+	default:
+		return fmt.Errorf("unknown decorator %s", d.Type)
+	}
+	return nil
+}
+
+// Advance sets the current tick of the Decorator and of any decorator it wraps
+func (d *Decorator) Advance(tick int64) {
+	d.tick = tick
+	if ticker, ok := d.Task.(Ticker); ok {
+		ticker.Advance(tick)
+	}
+}
+
+// Ready reports whether the Decorator allows the task to start, which is only ever false while cooling down
+func (d *Decorator) Ready() bool {
+	if d.Type != Cooldown || !d.finished || d.Status() == Running {
+		return true
+	}
+	if d.Ticks > 0 && d.tick-d.finishTick < d.Ticks {
+		return false
+	}
+	if d.Duration > 0 && d.now().Sub(d.finishedAt) < d.Duration {
+		return false
+	}
+	return true
+}
+
+func (d *Decorator) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	state.Log().Debug("executing decorator", logging.Task(d.Name()), logging.F("decorator", d.Type), logging.F("status", d.Status()))
+	if !d.Ready() {
+		return d.Status(), nil
+	}
+	if !d.started {
+		d.started = true
+		d.startedTick = d.tick
+		d.startedAt = d.now()
+	}
+	var status TaskStatus
+	var err error
+	switch d.Type {
+	case Repeat:
+		status, err = d.repeat(ctx, state)
+	case Retry:
+		status, err = d.retry(ctx, state)
+	case Timeout:
+		status, err = d.timeout(ctx, state)
+	case Cooldown:
+		status, err = d.Task.Execute(ctx, state)
+	case Invert:
+		status, err = d.invert(ctx, state)
+	default:
+		return Failed, fmt.Errorf("unknown decorator %s", d.Type)
+	}
+	d.TaskStatus = status
+	if status.IsDone() {
+		d.finished = true
+		d.finishTick = d.tick
+		d.finishedAt = d.now()
+	}
+	return d.TaskStatus, err
+}
+
+func (d *Decorator) now() time.Time {
+	return clock.OrReal(d.Clock).Now()
+}
+
+func (d *Decorator) repeat(ctx context.Context, state *State) (TaskStatus, error) {
+	if d.Until != nil && isMet(d.Until, state) {
+		return Succeeded, nil
+	}
+	status, err := d.Task.Execute(ctx, state)
+	if err != nil || status != Succeeded {
+		return status, err
+	}
+	d.runs++
+	if d.Until != nil && isMet(d.Until, state) {
+		return Succeeded, nil
+	}
+	if d.Until == nil && d.runs >= d.Count {
+		return Succeeded, nil
+	}
+	state.Log().Debug("repeating task", logging.Task(d.Name()), logging.F("runs", d.runs))
+	d.Task.Reset()
+	return Running, nil
+}
+
+func (d *Decorator) retry(ctx context.Context, state *State) (TaskStatus, error) {
+	if d.tick < d.retryAt {
+		return Running, nil
+	}
+	status, err := d.Task.Execute(ctx, state)
+	// a cancelled context is not a failure worth retrying
+	if ctx.Err() != nil {
+		return Cancelled, ctx.Err()
+	}
+	if err != nil {
+		state.Log().Warn("task failed", logging.Task(d.Name()), logging.Err(err))
+		status = Failed
+	}
+	if status != Failed {
+		return status, nil
+	}
+	if d.runs >= d.Count {
+		return Failed, nil
+	}
+	d.runs++
+	// the backoff doubles with every retry
+	d.retryAt = d.tick + d.Ticks<<(d.runs-1)
+	state.Log().Info("retrying task", logging.Task(d.Name()), logging.F("retry", d.runs), logging.F("retries", d.Count), logging.F("at", d.retryAt))
+	d.Task.Reset()
+	return Running, nil
+}
+
+// timeout runs the task under a context that is done once the time is up on the Clock, so an action that honours the
+// context stops in time
+func (d *Decorator) timeout(ctx context.Context, state *State) (TaskStatus, error) {
+	if (d.Ticks > 0 && d.tick-d.startedTick >= d.Ticks) || (d.Duration > 0 && d.now().Sub(d.startedAt) >= d.Duration) {
+		state.Log().Info("task timed out", logging.Task(d.Name()))
+		d.Task.Cancel()
+		return Failed, nil
+	}
+	if d.Duration <= 0 {
+		return d.Task.Execute(ctx, state)
+	}
+	deadlineCtx, cancel := clock.WithDeadline(ctx, d.Clock, d.startedAt.Add(d.Duration))
+	defer cancel()
+	status, err := d.Task.Execute(deadlineCtx, state)
+	if err != nil && ctx.Err() == nil && errors.Is(deadlineCtx.Err(), context.DeadlineExceeded) {
+		state.Log().Info("task timed out", logging.Task(d.Name()), logging.Err(err))
+		d.Task.Cancel()
+		return Failed, nil
+	}
+	return status, err
+}
+
+func (d *Decorator) invert(ctx context.Context, state *State) (TaskStatus, error) {
+	status, err := d.Task.Execute(ctx, state)
+	if ctx.Err() != nil {
+		return Cancelled, ctx.Err()
+	}
+	if err != nil {
+		state.Log().Warn("task failed", logging.Task(d.Name()), logging.Err(err))
+		status = Failed
+	}
+	switch status {
+	case Succeeded:
+		return Failed, nil
+	case Failed:
+		return Succeeded, nil
+	}
+	return status, nil
+}
+
+func (d *Decorator) Status() TaskStatus {
+	return d.TaskStatus.orPending()
+}
+
+func (d *Decorator) IsComplete() bool {
+	return d.Status() == Succeeded
+}
+
+func (d *Decorator) Cancel() {
+	d.Task.Cancel()
+	if d.Status() == Running {
+		d.TaskStatus = Cancelled
+	}
+}
+
+// Reset returns the Decorator and the wrapped task to Pending.  A Cooldown keeps the time it last finished, so the
+// cooldown still applies after the task is reset.
+func (d *Decorator) Reset() {
+	d.TaskStatus = Pending
+	d.runs = 0
+	d.started = false
+	d.retryAt = 0
+	d.Task.Reset()
+}
+
+// Policy returns the reset policy of the wrapped task, so a decorated task repeats like the task it wraps
+func (d *Decorator) Policy() *ResetPolicy {
+	if repeatable, ok := d.Task.(Repeatable); ok {
+		return repeatable.Policy()
+	}
+	return nil
+}
+
+func (d *Decorator) Parameters() []string {
+	if parameterized, ok := d.Task.(Parameterized); ok {
+		return parameterized.Parameters()
+	}
+	return nil
+}
+
+// Ground returns the instance of the task bound to the arguments, wrapped in a Decorator of its own
+func (d *Decorator) Ground(arguments []any) (Task, error) {
+	parameterized, ok := d.Task.(Parameterized)
+	if !ok {
+		return nil, fmt.Errorf("task %s does not take parameters", d.Name())
+	}
+	task, err := parameterized.Ground(arguments)
+	if err != nil {
+		return nil, err
+	}
+	return d.instances.get(task.Name(), arguments, func() Task {
+		return &Decorator{
+			Type:     d.Type,
+			Task:     task,
+			Count:    d.Count,
+			Until:    d.Until,
+			Ticks:    d.Ticks,
+			Duration: d.Duration,
+			Clock:    d.Clock,
+		}
+	}), nil
+}
+
+func (d *Decorator) Instances() []Task {
+	return d.instances.all()
+}
+
+// Evict drops the instances of the Decorator and of its task bound to an actor that is no longer among the actors
+func (d *Decorator) Evict(actors actor.Actors) {
+	d.instances.evict(actors)
+	Evict(d.Task, actors)
+}
+
+func (d *Decorator) Name() string {
+	return d.Task.Name()
+}
+
+func (d *Decorator) String() string {
+	return fmt.Sprintf("%s {%s}, status: %s", d.Type, d.Task.String(), d.Status())
+}
+
+// Ticker is implemented by tasks that count ticks
+type Ticker interface {
+	Advance(tick int64)
+}
+
+var _ Repeatable = &Decorator{}
+var _ Parameterized = &Decorator{}
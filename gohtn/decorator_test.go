@@ -0,0 +1,134 @@
+package gohtn
+
+import (
+	"context"
+	"github.com/cory-johannsen/gohtn/clock"
+	"testing"
+	"time"
+)
+
+// counting returns a task finishing with the status every time it runs, and the number of times it ran
+func counting(name string, status TaskStatus) (*PrimitiveTask, *int) {
+	runs := 0
+	task := &PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			runs++
+			return status, nil
+		},
+	}
+	return task, &runs
+}
+
+// executeAt advances the decorator to the tick and executes it
+func executeAt(t *testing.T, decorator *Decorator, tick int64) TaskStatus {
+	t.Helper()
+	decorator.Advance(tick)
+	status, err := decorator.Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestRepeatRunsTheTaskCountTimes(t *testing.T) {
+	task, runs := counting("Knock", Succeeded)
+	repeat := &Decorator{Type: Repeat, Task: task, Count: 3}
+	for tick := int64(0); tick < 2; tick++ {
+		if status := executeAt(t, repeat, tick); status != Running {
+			t.Fatalf("expected the repeat to be running after %d runs, got %s", *runs, status)
+		}
+	}
+	if status := executeAt(t, repeat, 2); status != Succeeded || *runs != 3 {
+		t.Fatalf("expected the repeat to succeed after 3 runs, got %s after %d", status, *runs)
+	}
+}
+
+func TestRetryBacksOffBeforeEachRetry(t *testing.T) {
+	task, runs := counting("Unlock", Failed)
+	retry := &Decorator{Type: Retry, Task: task, Count: 2, Ticks: 1}
+	expected := []struct {
+		status TaskStatus
+		runs   int
+	}{
+		{status: Running, runs: 1},
+		{status: Running, runs: 2},
+		{status: Running, runs: 2},
+		{status: Failed, runs: 3},
+	}
+	for tick, step := range expected {
+		status := executeAt(t, retry, int64(tick))
+		if status != step.status || *runs != step.runs {
+			t.Fatalf("tick %d: expected %s after %d runs, got %s after %d", tick, step.status, step.runs, status, *runs)
+		}
+	}
+}
+
+func TestTimeoutCancelsAnActionOnceTheDurationPasses(t *testing.T) {
+	manual := clock.NewManual(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	started := make(chan struct{})
+	task := &PrimitiveTask{
+		TaskName: "Haggle",
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			close(started)
+			<-ctx.Done()
+			return Failed, ctx.Err()
+		},
+	}
+	timeout := &Decorator{Type: Timeout, Task: task, Duration: time.Minute, Clock: manual}
+	go func() {
+		<-started
+		manual.Advance(time.Minute)
+	}()
+	if status := executeAt(t, timeout, 0); status != Failed {
+		t.Fatalf("expected the timed out task to fail, got %s", status)
+	}
+}
+
+func TestTimeoutFailsARunningTaskOnceTheDurationPasses(t *testing.T) {
+	manual := clock.NewManual(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	task, _ := counting("Wait", Running)
+	timeout := &Decorator{Type: Timeout, Task: task, Duration: time.Minute, Clock: manual}
+	if status := executeAt(t, timeout, 0); status != Running {
+		t.Fatalf("expected the task to be running, got %s", status)
+	}
+	manual.Advance(time.Minute)
+	if status := executeAt(t, timeout, 1); status != Failed {
+		t.Fatalf("expected the task to time out, got %s", status)
+	}
+	if task.Status() != Cancelled {
+		t.Fatalf("expected the timed out task to be cancelled, got %s", task.Status())
+	}
+}
+
+func TestCooldownHoldsTheTaskBackUntilTheDurationPasses(t *testing.T) {
+	manual := clock.NewManual(time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC))
+	task, runs := counting("Shout", Succeeded)
+	cooldown := &Decorator{Type: Cooldown, Task: task, Duration: time.Hour, Clock: manual}
+	if status := executeAt(t, cooldown, 0); status != Succeeded {
+		t.Fatalf("expected the task to succeed, got %s", status)
+	}
+	cooldown.Reset()
+	manual.Advance(59 * time.Minute)
+	if cooldown.Ready() {
+		t.Fatal("expected the task to be cooling down")
+	}
+	manual.Advance(time.Minute)
+	if !cooldown.Ready() {
+		t.Fatal("expected the cooldown to be over")
+	}
+	if status := executeAt(t, cooldown, 1); status != Succeeded || *runs != 2 {
+		t.Fatalf("expected the task to run again, got %s after %d runs", status, *runs)
+	}
+}
+
+func TestInvertSwapsSuccessAndFailure(t *testing.T) {
+	succeeding, _ := counting("Open", Succeeded)
+	failing, _ := counting("Close", Failed)
+	if status := executeAt(t, &Decorator{Type: Invert, Task: succeeding}, 0); status != Failed {
+		t.Fatalf("expected success to be inverted, got %s", status)
+	}
+	if status := executeAt(t, &Decorator{Type: Invert, Task: failing}, 0); status != Succeeded {
+		t.Fatalf("expected failure to be inverted, got %s", status)
+	}
+}
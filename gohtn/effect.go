@@ -0,0 +1,175 @@
+package gohtn
+
+import "fmt"
+
+type EffectOperation string
+
+const (
+	SetProperty       EffectOperation = "set"
+	IncrementProperty EffectOperation = "increment"
+	ClearProperty     EffectOperation = "clear"
+)
+
+type number interface {
+	~int | ~int64 | ~float64
+}
+
+// Effect is a declared change to a named Property that a Task makes to the world once it completes.  The planner
+// applies effects to a simulated State so later steps see the world as it will be after the earlier ones.
+type Effect struct {
+	Operation EffectOperation `json:"operation"`
+	Property  string          `json:"property"`
+	Value     float64         `json:"value,omitempty"`
+}
+
+func (e *Effect) Validate() error {
+	switch e.Operation {
+	case SetProperty, IncrementProperty, ClearProperty:
+	default:
+		return fmt.Errorf("unknown effect operation %s", e.Operation)
+	}
+	if len(e.Property) == 0 {
+		return fmt.Errorf("effect %s has no property", e.Operation)
+	}
+	return nil
+}
+
+// Apply replaces the Property in the State with a constant Property of the same type holding the result of the effect
+func (e *Effect) Apply(state *State) error {
+	err := e.Validate()
+	if err != nil {
+		return err
+	}
+	if state.Properties == nil {
+		state.Properties = make(map[string]any)
+	}
+	return state.Update(func(state *State) error {
+		switch property := state.Properties[e.Property].(type) {
+		case nil:
+			state.Properties[e.Property] = applyEffect[float64](e, nil, state)
+		case *Property[float64]:
+			state.Properties[e.Property] = applyEffect(e, property, state)
+		case *Property[int64]:
+			state.Properties[e.Property] = applyEffect(e, property, state)
+		case *Property[int]:
+			state.Properties[e.Property] = applyEffect(e, property, state)
+		default:
+			return fmt.Errorf("effect %s can not be applied to property %s of type %T", e.Operation, e.Property, property)
+		}
+		return nil
+	})
+}
+
+func (e *Effect) String() string {
+	if e.Operation == ClearProperty {
+		return fmt.Sprintf("%s %s", e.Operation, e.Property)
+	}
+	return fmt.Sprintf("%s %s %v", e.Operation, e.Property, e.Value)
+}
+
+// applyEffect returns the fact holding the result of the effect on the Property, which is nil when the effect creates
+// it.  The fact keeps the Property it first replaced as its origin.
+func applyEffect[T number](e *Effect, property *Property[T], state *State) *Property[T] {
+	var value T
+	var origin *Property[T]
+	if property != nil {
+		origin = property
+		if property.fact {
+			origin = property.origin
+		}
+	}
+	switch e.Operation {
+	case SetProperty:
+		value = T(e.Value)
+	case IncrementProperty:
+		if property != nil && property.Value != nil {
+			value = property.Value(state)
+		}
+		value += T(e.Value)
+	}
+	return &Property[T]{
+		Name: e.Property,
+		Value: func(state *State) T {
+			return value
+		},
+		fact:   true,
+		origin: origin,
+	}
+}
+
+// Facts returns the values of the properties of the State that were set by effects
+func Facts(state *State) map[string]float64 {
+	defer state.rlock()()
+	facts := make(map[string]float64)
+	for name, property := range state.Properties {
+		switch p := property.(type) {
+		case *Property[float64]:
+			if p.fact {
+				facts[name] = p.Value(state)
+			}
+		case *Property[int64]:
+			if p.fact {
+				facts[name] = float64(p.Value(state))
+			}
+		case *Property[int]:
+			if p.fact {
+				facts[name] = float64(p.Value(state))
+			}
+		}
+	}
+	return facts
+}
+
+// RestoreFacts sets the properties of the State to the values of the facts, keeping the type of the properties.  Facts
+// of the State missing from the facts are undone: the property an effect replaced is put back, and one an effect
+// created is removed.
+func RestoreFacts(state *State, facts map[string]float64) error {
+	err := state.Update(func(state *State) error {
+		for name, property := range state.Properties {
+			if _, ok := facts[name]; ok {
+				continue
+			}
+			switch p := property.(type) {
+			case *Property[float64]:
+				undoFact(state, name, p)
+			case *Property[int64]:
+				undoFact(state, name, p)
+			case *Property[int]:
+				undoFact(state, name, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for name, value := range facts {
+		err := (&Effect{Operation: SetProperty, Property: name, Value: value}).Apply(state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoFact puts back the property the fact replaced, or removes the fact when an effect created it
+func undoFact[T number](state *State, name string, property *Property[T]) {
+	if !property.fact {
+		return
+	}
+	if property.origin == nil {
+		delete(state.Properties, name)
+		return
+	}
+	state.Properties[name] = property.origin
+}
+
+func applyEffects(effects []*Effect, state *State) error {
+	for _, effect := range effects {
+		err := effect.Apply(state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
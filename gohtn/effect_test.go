@@ -0,0 +1,34 @@
+package gohtn
+
+import "testing"
+
+func TestRestoreFactsUndoesFactsMissingFromTheSnapshot(t *testing.T) {
+	state := newState()
+	state.Properties["Gold"] = &Property[int]{Name: "Gold", Value: func(state *State) int {
+		return 5
+	}}
+	for _, effect := range []*Effect{
+		{Operation: IncrementProperty, Property: "Gold", Value: 2},
+		{Operation: IncrementProperty, Property: "Gold", Value: 3},
+		{Operation: SetProperty, Property: "Tired", Value: 1},
+	} {
+		err := effect.Apply(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := RestoreFacts(state, map[string]float64{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := state.Properties["Tired"]; ok {
+		t.Fatal("expected the property created by an effect to be removed")
+	}
+	gold, ok := state.Properties["Gold"].(*Property[int])
+	if !ok || gold.fact || gold.Value(state) != 5 {
+		t.Fatalf("expected the property replaced by effects to be put back, got %v", state.Properties["Gold"])
+	}
+	if len(Facts(state)) != 0 {
+		t.Fatalf("expected no facts, got %v", Facts(state))
+	}
+}
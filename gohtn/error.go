@@ -0,0 +1,139 @@
+package gohtn
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrPreconditionNotMet = errors.New("precondition not met")
+	ErrNoApplicableMethod = errors.New("no applicable method")
+	ErrMethodsExhausted   = errors.New("every applicable method failed")
+	ErrMaxDepthExceeded   = errors.New("maximum decomposition depth exceeded")
+	ErrGoalUnreachable    = errors.New("goal can not be reached")
+	ErrCoolingDown        = errors.New("task is cooling down")
+)
+
+// MethodFailure records why a decomposition through a Method was abandoned
+type MethodFailure struct {
+	Method string
+	Err    error
+}
+
+func (m *MethodFailure) String() string {
+	return fmt.Sprintf("method %s: %v", m.Method, m.Err)
+}
+
+// DecompositionError reports a Task the planner could not decompose.  Err is one of the sentinel errors above, and
+// for compound tasks Alternatives holds the failure of every Method that was tried, in priority order.  For goals it
+// holds the failure of every candidate task that was tried, keyed by the task name.
+type DecompositionError struct {
+	Task         string
+	Err          error
+	Condition    string
+	Alternatives []*MethodFailure
+}
+
+func (d *DecompositionError) Error() string {
+	message := fmt.Sprintf("task %s: %v", d.Task, d.Err)
+	if len(d.Condition) > 0 {
+		message = fmt.Sprintf("%s {%s}", message, d.Condition)
+	}
+	if len(d.Alternatives) > 0 {
+		alternatives := make([]string, 0)
+		for _, alternative := range d.Alternatives {
+			alternatives = append(alternatives, alternative.String())
+		}
+		message = fmt.Sprintf("%s [%s]", message, strings.Join(alternatives, "; "))
+	}
+	return message
+}
+
+func (d *DecompositionError) Unwrap() error {
+	return d.Err
+}
+
+// PlanningError is returned by the Planner when none of the incomplete root tasks could be decomposed
+type PlanningError struct {
+	Failures []*DecompositionError
+}
+
+func (p *PlanningError) Error() string {
+	failures := make([]string, 0)
+	for _, failure := range p.Failures {
+		failures = append(failures, failure.Error())
+	}
+	return fmt.Sprintf("no root task could be decomposed: %s", strings.Join(failures, ", "))
+}
+
+func (p *PlanningError) Unwrap() error {
+	if len(p.Failures) == 0 {
+		return nil
+	}
+	return p.Failures[0]
+}
+
+func isDecompositionFailure(err error) bool {
+	var decompositionError *DecompositionError
+	return errors.As(err, &decompositionError)
+}
+
+// ParallelError aggregates the errors of the branches of a parallel task, in branch order
+type ParallelError struct {
+	Task   string
+	Errors []error
+}
+
+func (p *ParallelError) Error() string {
+	errs := make([]string, 0, len(p.Errors))
+	for _, err := range p.Errors {
+		errs = append(errs, err.Error())
+	}
+	return fmt.Sprintf("parallel task %s: %s", p.Task, strings.Join(errs, "; "))
+}
+
+func (p *ParallelError) Unwrap() []error {
+	return p.Errors
+}
+
+// CompensationFailure records a compensating action that did not succeed during a rollback
+type CompensationFailure struct {
+	Task string
+	Err  error
+}
+
+func (c *CompensationFailure) String() string {
+	return fmt.Sprintf("task %s: %v", c.Task, c.Err)
+}
+
+// RollbackError is returned by an Executor that rolled back a failed plan.  Step and Task name the step that failed
+// and Err is the error it returned, which is nil when the step simply Failed.  RolledBack names every task whose
+// compensating action ran, most recent first, and Failures holds the compensations that did not succeed.
+type RollbackError struct {
+	Step       int
+	Task       string
+	Err        error
+	RolledBack []string
+	Failures   []*CompensationFailure
+}
+
+func (r *RollbackError) Error() string {
+	message := fmt.Sprintf("step %d task %s failed", r.Step, r.Task)
+	if r.Err != nil {
+		message = fmt.Sprintf("%s: %v", message, r.Err)
+	}
+	message = fmt.Sprintf("%s, rolled back [%s]", message, strings.Join(r.RolledBack, ", "))
+	if len(r.Failures) > 0 {
+		failures := make([]string, 0, len(r.Failures))
+		for _, failure := range r.Failures {
+			failures = append(failures, failure.String())
+		}
+		message = fmt.Sprintf("%s, compensations failed [%s]", message, strings.Join(failures, "; "))
+	}
+	return message
+}
+
+func (r *RollbackError) Unwrap() error {
+	return r.Err
+}
@@ -0,0 +1,132 @@
+package gohtn
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/clock"
+	"time"
+)
+
+type EventType string
+
+const (
+	// TaskStarted is emitted when a primitive task starts its action
+	TaskStarted EventType = "taskStarted"
+	// TaskCompleted is emitted when a task succeeds
+	TaskCompleted EventType = "taskCompleted"
+	// TaskFailed is emitted when a task fails or returns an error
+	TaskFailed EventType = "taskFailed"
+	// TaskCancelled is emitted when a task is interrupted by its context
+	TaskCancelled EventType = "taskCancelled"
+	// TaskSkipped is emitted when a primitive task does not run because a precondition is not met
+	TaskSkipped EventType = "taskSkipped"
+	// MethodSelected is emitted when a compound task selects a method, either by executing it or through a plan
+	MethodSelected EventType = "methodSelected"
+	// PlanBuilt is emitted when the planner has built a plan
+	PlanBuilt EventType = "planBuilt"
+	// PlanAbandoned is emitted when the executor abandons a plan the world has invalidated
+	PlanAbandoned EventType = "planAbandoned"
+)
+
+// Event describes something that happened while an agent planned or executed.  Only the fields that apply to the Type
+// are set: Task for task and method events, Method for MethodSelected, Plan for plan events, and Reason for
+// TaskSkipped and PlanAbandoned.  Agent is set by the engine publishing the event.
+type Event struct {
+	Type   EventType
+	Time   time.Time
+	Agent  string
+	Task   string
+	Method string
+	Status TaskStatus
+	Plan   *Plan
+	Reason string
+	Err    error
+}
+
+func (e Event) String() string {
+	message := string(e.Type)
+	if len(e.Agent) > 0 {
+		message = fmt.Sprintf("%s agent %s", message, e.Agent)
+	}
+	if len(e.Task) > 0 {
+		message = fmt.Sprintf("%s task %s", message, e.Task)
+	}
+	if len(e.Method) > 0 {
+		message = fmt.Sprintf("%s method %s", message, e.Method)
+	}
+	if e.Plan != nil {
+		message = fmt.Sprintf("%s %s", message, e.Plan.String())
+	}
+	if len(e.Reason) > 0 {
+		message = fmt.Sprintf("%s: %s", message, e.Reason)
+	}
+	if e.Err != nil {
+		message = fmt.Sprintf("%s: %v", message, e.Err)
+	}
+	return message
+}
+
+// Emitter receives the events of a Planner or an Executor.  Events may be emitted from several goroutines at once when
+// tasks run in parallel.
+type Emitter interface {
+	Emit(event Event)
+}
+
+type emitterKey struct{}
+
+// WithEmitter returns a context carrying the Emitter, which tasks executed under the context emit their events to
+func WithEmitter(ctx context.Context, emitter Emitter) context.Context {
+	return context.WithValue(ctx, emitterKey{}, emitter)
+}
+
+// emit sends the event to the Emitter of the context, if there is one
+func emit(ctx context.Context, event Event) {
+	emitter, ok := ctx.Value(emitterKey{}).(Emitter)
+	if !ok {
+		return
+	}
+	emitTo(emitter, event)
+}
+
+func emitTo(emitter Emitter, event Event) {
+	if emitter == nil {
+		return
+	}
+	event.Time = clock.Real.Now()
+	emitter.Emit(event)
+}
+
+// clockEmitter stamps the events it forwards with the time on its Clock
+type clockEmitter struct {
+	clock clock.Clock
+	next  Emitter
+}
+
+// stampEvents returns an Emitter that stamps events with the time on the Clock before forwarding them to the Emitter
+func stampEvents(events Emitter, c clock.Clock) Emitter {
+	if events == nil {
+		return nil
+	}
+	return &clockEmitter{clock: clock.OrReal(c), next: events}
+}
+
+func (c *clockEmitter) Emit(event Event) {
+	event.Time = c.clock.Now()
+	c.next.Emit(event)
+}
+
+// taskEvent returns the event reporting the status a task finished an execution with
+func taskEvent(task Task, status TaskStatus, err error) (Event, bool) {
+	event := Event{Task: task.Name(), Status: status, Err: err}
+	switch {
+	case status == Cancelled:
+		event.Type = TaskCancelled
+	case err != nil || status == Failed:
+		event.Type = TaskFailed
+	case status == Succeeded:
+		event.Type = TaskCompleted
+	default:
+		return event, false
+	}
+	return event, true
+}
@@ -0,0 +1,46 @@
+package gohtn
+
+import (
+	"context"
+	"github.com/cory-johannsen/gohtn/clock"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the events emitted to it
+type recorder struct {
+	events []Event
+	mutex  sync.Mutex
+}
+
+func (r *recorder) Emit(event Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestEventsAreStampedWithTheTimeOnTheClock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	manual := clock.NewManual(now)
+	events := &recorder{}
+	greet := primitive("Greet", Succeeded)
+	planner := &Planner{Tasks: graph(greet), Events: events, Clock: manual}
+	state := newState()
+	plan, err := planner.Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Executor{Events: events, Clock: manual}).Execute(context.Background(), plan, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.events) == 0 {
+		t.Fatal("expected events to be emitted")
+	}
+	for _, event := range events.events {
+		if !event.Time.Equal(now) {
+			t.Fatalf("expected the %s event at %v, got %v", event.Type, now, event.Time)
+		}
+	}
+}
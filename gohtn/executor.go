@@ -0,0 +1,260 @@
+package gohtn
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/logging"
+)
+
+// DefaultMaxReplans bounds how many times an Executor replans a single execution when it does not specify a limit
+const DefaultMaxReplans = 8
+
+// Invalidation explains why a Plan was abandoned: the step at index Step, running Task, would no longer have its
+// Condition met once the steps before it have run.
+type Invalidation struct {
+	Plan      *Plan
+	Step      int
+	Task      string
+	Condition string
+}
+
+func (i *Invalidation) String() string {
+	return fmt.Sprintf("step %d task %s precondition {%s} no longer met", i.Step, i.Task, i.Condition)
+}
+
+// PlanInvalidatedError is returned when a Plan is invalidated and the Executor can not replan
+type PlanInvalidatedError struct {
+	Invalidation *Invalidation
+}
+
+func (p *PlanInvalidatedError) Error() string {
+	return fmt.Sprintf("plan invalidated: %s", p.Invalidation.String())
+}
+
+// Execution reports what an Executor did: the tasks it executed, every plan it abandoned along the way, and the Plan
+// it was running when it stopped.  Status is Succeeded when the whole plan ran, Running when a long-running task is
+// still in progress, and otherwise the status of the step that stopped execution.
+type Execution struct {
+	Executed   []Task
+	Abandoned  []*Invalidation
+	RolledBack []Task
+	Plan       *Plan
+	Status     TaskStatus
+}
+
+// Executor runs a Plan step by step, replanning when a world change invalidates a later step, and stops at the first
+// step that does not succeed.  With Rollback set, a failed step compensates the steps completed since the plan last
+// ran to the end, including those of earlier calls to Execute, most recent first.
+type Executor struct {
+	Planner    *Planner
+	MaxReplans int
+	Rollback   bool
+	Events     Emitter
+	Clock      clock.Clock
+	Logger     logging.Logger
+	Metrics    Metrics
+	completed  []Task
+}
+
+// Forget drops the steps completed by earlier calls to Execute, e.g. once the agent works towards another goal, so a
+// later failure does not roll them back
+func (e *Executor) Forget() {
+	e.completed = nil
+}
+
+// remember keeps the steps of the execution that are still complete for a later rollback
+func (e *Executor) remember(executed []Task) {
+	completed := make([]Task, 0, len(e.completed)+len(executed))
+	for _, task := range append(e.completed, executed...) {
+		if task.IsComplete() || task.Status() == Running {
+			completed = append(completed, task)
+		}
+	}
+	e.completed = completed
+}
+
+func (e *Executor) maxReplans() int {
+	if e.MaxReplans > 0 {
+		return e.MaxReplans
+	}
+	return DefaultMaxReplans
+}
+
+func (e *Executor) Execute(ctx context.Context, plan *Plan, state *State) (*Execution, error) {
+	if e.Logger != nil {
+		state = state.WithLogger(e.Logger)
+	}
+	logger := state.Log()
+	logger.Debug("executing plan", logging.F("tasks", len(plan.Tasks)))
+	execution := &Execution{
+		Executed:  make([]Task, 0),
+		Abandoned: make([]*Invalidation, 0),
+		Plan:      plan,
+		Status:    Pending,
+	}
+	if e.Metrics != nil {
+		state = state.WithMetrics(e.Metrics)
+	}
+	if events := countEvents(stampEvents(e.Events, e.Clock), e.Metrics); events != nil {
+		ctx = WithEmitter(ctx, events)
+	}
+	planCtx, cancel := planContext(ctx)
+	defer func() {
+		cancel()
+	}()
+	finished := false
+	defer func() {
+		if !finished {
+			e.remember(execution.Executed)
+		}
+	}()
+	step := 0
+	for step < len(plan.Tasks) {
+		if ctx.Err() != nil {
+			logger.Info("execution cancelled", logging.Err(ctx.Err()))
+			plan.cancel()
+			execution.Status = Cancelled
+			return execution, ctx.Err()
+		}
+		invalidation := plan.Validate(step, state)
+		if invalidation != nil {
+			logger.Info("abandoning plan", logging.F("reason", invalidation.String()))
+			execution.Abandoned = append(execution.Abandoned, invalidation)
+			emit(ctx, Event{Type: PlanAbandoned, Plan: plan, Reason: invalidation.String()})
+			cancel()
+			plan.cancel()
+			if e.Planner == nil || len(execution.Abandoned) > e.maxReplans() {
+				return execution, &PlanInvalidatedError{Invalidation: invalidation}
+			}
+			replanned, err := e.Planner.Plan(state)
+			if err != nil {
+				return execution, err
+			}
+			logger.Info("replanned", logging.F("tasks", len(replanned.Tasks)))
+			planCtx, cancel = planContext(ctx)
+			plan = replanned
+			execution.Plan = plan
+			step = 0
+			continue
+		}
+		task := plan.Tasks[step]
+		status, err := task.Execute(planCtx, state)
+		execution.Status = status
+		if err == nil {
+			execution.Executed = append(execution.Executed, task)
+		}
+		// a cancelled context is a shutdown rather than a failure, so there is nothing to roll back
+		if e.Rollback && (err != nil || status == Failed) && ctx.Err() == nil {
+			finished = true
+			return execution, e.rollback(ctx, execution, step, task, err, state)
+		}
+		if err != nil {
+			return execution, err
+		}
+		if status != Succeeded {
+			logger.Debug("stopping execution", logging.Task(task.Name()), logging.F("status", status))
+			return execution, nil
+		}
+		step++
+	}
+	execution.Status = Succeeded
+	finished = true
+	e.Forget()
+	return execution, nil
+}
+
+// rollback runs the compensating actions of the tasks completed by earlier executions and by this one, most recent
+// first.  A failed compensation is recorded and the rollback carries on with the tasks before it.
+func (e *Executor) rollback(ctx context.Context, execution *Execution, step int, failed Task, cause error, state *State) *RollbackError {
+	logger := state.Log()
+	logger.Warn("task failed, rolling back", logging.Task(failed.Name()), logging.F("step", step))
+	rollbackError := &RollbackError{Step: step, Task: failed.Name(), Err: cause, RolledBack: make([]string, 0)}
+	executed := make([]Task, 0, len(e.completed)+len(execution.Executed)+1)
+	seen := make(map[Task]bool)
+	for _, task := range append(append(e.completed[:len(e.completed):len(e.completed)], execution.Executed...), failed) {
+		if !seen[task] {
+			seen[task] = true
+			executed = append(executed, task)
+		}
+	}
+	e.Forget()
+	for i := len(executed) - 1; i >= 0; i-- {
+		tasks := steps(executed[i])
+		for j := len(tasks) - 1; j >= 0; j-- {
+			task := tasks[j]
+			primitive, ok := undecorated(task).(*PrimitiveTask)
+			if !ok || !task.IsComplete() || primitive.Compensation == nil {
+				continue
+			}
+			logger.Debug("compensating task", logging.Task(task.Name()))
+			status, err := primitive.Compensation(ctx, state.Bind(primitive.Arguments))
+			if err == nil && status != Succeeded {
+				err = fmt.Errorf("compensation is %s", status)
+			}
+			if err != nil {
+				logger.Error("compensation failed", logging.Task(task.Name()), logging.Err(err))
+				rollbackError.Failures = append(rollbackError.Failures, &CompensationFailure{Task: task.Name(), Err: err})
+				continue
+			}
+			task.Reset()
+			execution.RolledBack = append(execution.RolledBack, task)
+			rollbackError.RolledBack = append(rollbackError.RolledBack, task.Name())
+		}
+	}
+	return rollbackError
+}
+
+// planContext derives the context a plan runs under, cancelled once the plan is abandoned or execution returns
+func planContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
+}
+
+// cancel cancels the Running tasks of the Plan
+func (p *Plan) cancel() {
+	for _, task := range p.Tasks {
+		task.Cancel()
+	}
+}
+
+// undecorated returns the task wrapped by any decorators
+func undecorated(task Task) Task {
+	for {
+		decorator, ok := task.(*Decorator)
+		if !ok {
+			return task
+		}
+		task = decorator.Task
+	}
+}
+
+// Validate simulates the steps of the Plan from the given index against a copy of the State and returns the first
+// step whose preconditions would not be met, or nil when the rest of the plan can still run.
+func (p *Plan) Validate(from int, state *State) *Invalidation {
+	simulated := state.Clone()
+	for step := from; step < len(p.Tasks); step++ {
+		if p.Tasks[step].IsComplete() {
+			continue
+		}
+		// the branches of a parallel step are simulated one after the other, as the planner did
+		for _, planned := range steps(p.Tasks[step]) {
+			task, ok := undecorated(planned).(*PrimitiveTask)
+			if !ok || task.IsComplete() {
+				continue
+			}
+			if task.Status() != Running {
+				bound := simulated.Bind(task.Arguments)
+				for _, condition := range task.Preconditions {
+					if !isMet(condition, bound) {
+						return &Invalidation{Plan: p, Step: step, Task: task.Name(), Condition: condition.String()}
+					}
+				}
+			}
+			err := applyEffects(task.Effects, simulated)
+			if err != nil {
+				return &Invalidation{Plan: p, Step: step, Task: task.Name(), Condition: err.Error()}
+			}
+		}
+	}
+	return nil
+}
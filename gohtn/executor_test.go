@@ -0,0 +1,264 @@
+package gohtn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// compensated returns a task that succeeds, recording its name in undone when it is compensated with the status
+func compensated(name string, undone *[]string, status TaskStatus) *PrimitiveTask {
+	task := primitive(name, Succeeded)
+	task.Compensation = func(ctx context.Context, state *State) (TaskStatus, error) {
+		*undone = append(*undone, name)
+		return status, nil
+	}
+	return task
+}
+
+func TestRollbackCompensatesSucceededStepsInReverse(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Succeeded)
+	load := compensated("Load", &undone, Succeeded)
+	drive := primitive("Drive", Failed)
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(pack, load, drive)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execution, err := (&Executor{Rollback: true}).Execute(context.Background(), plan, state)
+	var rollbackError *RollbackError
+	if !errors.As(err, &rollbackError) {
+		t.Fatalf("expected a rollback error, got %v", err)
+	}
+	if rollbackError.Task != "Drive" || len(rollbackError.Failures) != 0 {
+		t.Fatalf("expected the drive to be rolled back cleanly, got %v", rollbackError)
+	}
+	if len(undone) != 2 || undone[0] != "Load" || undone[1] != "Pack" {
+		t.Fatalf("expected Load then Pack to be compensated, got %v", undone)
+	}
+	if len(execution.RolledBack) != 2 || pack.Status() != Pending || load.Status() != Pending {
+		t.Fatalf("expected the rolled back tasks to be pending, got %s and %s", pack.Status(), load.Status())
+	}
+}
+
+func TestRollbackReportsFailedCompensations(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Failed)
+	drive := primitive("Drive", Failed)
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(pack, drive)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Executor{Rollback: true}).Execute(context.Background(), plan, state)
+	var rollbackError *RollbackError
+	if !errors.As(err, &rollbackError) {
+		t.Fatalf("expected a rollback error, got %v", err)
+	}
+	if len(rollbackError.Failures) != 1 || rollbackError.Failures[0].Task != "Pack" {
+		t.Fatalf("expected the compensation of Pack to fail, got %v", rollbackError.Failures)
+	}
+	if pack.Status() != Succeeded {
+		t.Fatalf("expected the task that was not compensated to stay done, got %s", pack.Status())
+	}
+}
+
+func TestWithoutRollbackAFailedStepCompensatesNothing(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Succeeded)
+	drive := primitive("Drive", Failed)
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(pack, drive)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Executor{}).Execute(context.Background(), plan, state)
+	var rollbackError *RollbackError
+	if errors.As(err, &rollbackError) || len(undone) != 0 {
+		t.Fatalf("expected no rollback, got %v and %v", err, undone)
+	}
+}
+
+func TestRollbackCompensatesStepsCompletedOnEarlierTicks(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Succeeded)
+	load := compensated("Load", &undone, Succeeded)
+	loads := 0
+	load.Action = func(ctx context.Context, state *State) (TaskStatus, error) {
+		loads++
+		if loads == 1 {
+			return Running, nil
+		}
+		return Succeeded, nil
+	}
+	drive := primitive("Drive", Failed)
+	planner := &Planner{Tasks: graph(pack, load, drive)}
+	executor := &Executor{Planner: planner, Rollback: true}
+	state := newState()
+	for tick := 0; tick < 2; tick++ {
+		plan, err := planner.Plan(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = executor.Execute(context.Background(), plan, state)
+		if tick == 0 && err != nil {
+			t.Fatal(err)
+		}
+		if tick == 1 {
+			var rollbackError *RollbackError
+			if !errors.As(err, &rollbackError) {
+				t.Fatalf("expected a rollback error, got %v", err)
+			}
+		}
+	}
+	if len(undone) != 2 || undone[0] != "Load" || undone[1] != "Pack" {
+		t.Fatalf("expected Load then Pack to be compensated, got %v", undone)
+	}
+	if pack.Status() != Pending {
+		t.Fatalf("expected the pack of the first tick to be rolled back, got %s", pack.Status())
+	}
+}
+
+func TestAFinishedPlanIsNotRolledBackLater(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Succeeded)
+	executor := &Executor{Rollback: true}
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(pack)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.Execute(context.Background(), plan, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = (&Planner{Tasks: graph(primitive("Drive", Failed))}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.Execute(context.Background(), plan, state)
+	var rollbackError *RollbackError
+	if !errors.As(err, &rollbackError) || len(undone) != 0 {
+		t.Fatalf("expected the finished plan to stay done, got %v and %v", err, undone)
+	}
+}
+
+// spilling returns a task whose action empties the stock, a change to the world its effects do not declare
+func spilling(name string) *PrimitiveTask {
+	task := primitive(name, Succeeded)
+	task.Action = func(ctx context.Context, state *State) (TaskStatus, error) {
+		return Succeeded, (&Effect{Operation: SetProperty, Property: "Stocked", Value: 0}).Apply(state)
+	}
+	return task
+}
+
+func TestAnInvalidatedPlanIsReplanned(t *testing.T) {
+	sell := &CompoundTask{TaskName: "Sell", Methods: []*Method{
+		method("FromStock", requiring("Deliver", "Stocked")),
+		method("ToOrder", primitive("Order", Succeeded)),
+	}}
+	open := spilling("Open")
+	planner := &Planner{Tasks: graph(open, sell)}
+	state := newState()
+	err := (&Effect{Operation: SetProperty, Property: "Stocked", Value: 1}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := planner.Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Open", "Deliver")
+	execution, err := (&Executor{Planner: planner}).Execute(context.Background(), plan, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(execution.Abandoned) != 1 || execution.Abandoned[0].Task != "Deliver" {
+		t.Fatalf("expected the plan to be abandoned at Deliver, got %v", execution.Abandoned)
+	}
+	expectPlan(t, execution.Plan, "Order")
+	if execution.Status != Succeeded || fmt.Sprint(names(execution.Executed)) != "[Open Order]" {
+		t.Fatalf("expected Open then Order to run, got %s after %v", execution.Status, names(execution.Executed))
+	}
+}
+
+func TestReplanningStopsAfterMaxReplans(t *testing.T) {
+	restocks := 0
+	restock := func() (Task, error) {
+		restocks++
+		task := spilling("Restock")
+		task.Effects = []*Effect{{Operation: SetProperty, Property: "Stocked", Value: 1}}
+		return task, nil
+	}
+	deliver := requiring("Deliver", "Stocked")
+	planner := &Planner{Tasks: &TaskGraph{Root: &TaskNode{
+		TaskResolver: restock,
+		Children:     []*TaskNode{{TaskResolver: resolver(deliver)}},
+	}}}
+	state := newState()
+	plan, err := planner.Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	execution, err := (&Executor{Planner: planner, MaxReplans: 2}).Execute(context.Background(), plan, state)
+	var invalidated *PlanInvalidatedError
+	if !errors.As(err, &invalidated) || invalidated.Invalidation.Task != "Deliver" {
+		t.Fatalf("expected the plan to be given up on at Deliver, got %v", err)
+	}
+	if len(execution.Abandoned) != 3 || restocks != 3 {
+		t.Fatalf("expected two replans of the abandoned plan, got %d abandoned plans and %d restocks", len(execution.Abandoned), restocks)
+	}
+	if deliver.Status() != Pending {
+		t.Fatalf("expected the delivery never to run, got %s", deliver.Status())
+	}
+}
+
+func TestCancellingTheContextStopsExecution(t *testing.T) {
+	started := make(chan struct{})
+	haggle := blocking("Haggle", started)
+	pay := primitive("Pay", Succeeded)
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(haggle, pay)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	execution, err := (&Executor{Rollback: true}).Execute(ctx, plan, state)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected execution to stop with the context, got %v", err)
+	}
+	if execution.Status != Cancelled || haggle.Status() != Cancelled || pay.Status() != Pending {
+		t.Fatalf("expected the haggle to be cancelled before paying, got %s, %s and %s", execution.Status, haggle.Status(), pay.Status())
+	}
+}
+
+func TestCancellingTheContextCancelsTheTasksStillRunning(t *testing.T) {
+	undone := make([]string, 0)
+	pack := compensated("Pack", &undone, Succeeded)
+	walk := primitive("Walk", Running)
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(pack, walk)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := &Executor{Rollback: true}
+	_, err = executor.Execute(context.Background(), plan, state)
+	if err != nil || walk.Status() != Running {
+		t.Fatalf("expected the walk to be running, got %s and %v", walk.Status(), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	execution, err := executor.Execute(ctx, plan, state)
+	if !errors.Is(err, context.Canceled) || execution.Status != Cancelled {
+		t.Fatalf("expected execution to be cancelled, got %s and %v", execution.Status, err)
+	}
+	if walk.Status() != Cancelled || pack.Status() != Succeeded || len(undone) != 0 {
+		t.Fatalf("expected the walk to be cancelled without rolling back the pack, got %s, %s and %v", walk.Status(), pack.Status(), undone)
+	}
+}
@@ -1,7 +1,9 @@
 package gohtn
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"strings"
 )
 
 type TaskNode struct {
@@ -13,54 +15,168 @@ type TaskGraph struct {
 	Root *TaskNode
 }
 
-type Plan []Task
-
-type Planner struct {
-	Tasks *TaskGraph
+// Network resolves the Task graph into the ordered list of root Tasks handed to the Planner.  The graph is read
+// in pre-order, so a node precedes its children and siblings keep their declared order.
+func (g *TaskGraph) Network() ([]Task, error) {
+	tasks := make([]Task, 0)
+	if g == nil || g.Root == nil {
+		return tasks, nil
+	}
+	var walk func(node *TaskNode) error
+	walk = func(node *TaskNode) error {
+		task, err := node.TaskResolver()
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, task)
+		for _, child := range node.Children {
+			err = walk(child)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := walk(g.Root)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, nil
 }
 
-func evaluateNode(node *TaskNode, state *State) []Task {
-	task, err := node.TaskResolver()
+// Subtree resolves the task and every task it can decompose into, including their grounded instances, in pre-order
+func Subtree(task Task) ([]Task, error) {
+	tasks := make([]Task, 0)
+	err := subtree(task, make(map[Task]bool), &tasks)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	log.Printf("evaluating task node {%s}", task.String())
-	tasks := make([]Task, 0)
-	if !task.IsComplete() {
-		log.Printf("task node {%s} is not complete", task.String())
-		tasks = append(tasks, task)
+	return tasks, nil
+}
+
+func subtree(task Task, visited map[Task]bool, tasks *[]Task) error {
+	if visited[task] {
+		return nil
 	}
-	for _, child := range node.Children {
-		childTasks := evaluateNode(child, state)
-		for _, childTask := range childTasks {
-			tasks = append([]Task{childTask}, tasks...)
+	visited[task] = true
+	*tasks = append(*tasks, task)
+	for _, instance := range Instances(task) {
+		if instance != task {
+			err := subtree(instance, visited, tasks)
+			if err != nil {
+				return err
+			}
 		}
 	}
-	return tasks
+	switch t := task.(type) {
+	case *CompoundTask:
+		for _, method := range t.Methods {
+			subtasks, err := method.Templates()
+			if err != nil {
+				return err
+			}
+			for _, subtask := range subtasks {
+				err = subtree(subtask, visited, tasks)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	case *Decorator:
+		return subtree(t.Task, visited, tasks)
+	case *GoalTask:
+		for _, candidate := range t.Candidates() {
+			err := subtree(candidate, visited, tasks)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Plan is an ordered list of primitive Tasks ready for execution, along with the total Cost of the decomposition
+// that produced it.  The subtasks of a parallel Method are planned as a single ParallelTask step.
+type Plan struct {
+	Tasks   []Task
+	Cost    float64
+	choices []*choice
+}
+
+// choice records the Method a compound task was decomposed through, and the Bindings of its variables
+type choice struct {
+	task     *CompoundTask
+	method   *Method
+	bindings Bindings
 }
 
-func (p *Planner) Plan(state *State) (Plan, error) {
-	log.Println("building plan")
-	plan := make(Plan, 0)
-	// walk the Task graph, starting at the root, and find the executable plan
-	node := p.Tasks.Root
-	if node != nil {
-		tasks := evaluateNode(node, state)
-		for _, task := range tasks {
-			plan = append(plan, task)
+func (p *Plan) contains(task Task) bool {
+	for _, step := range p.Tasks {
+		for _, planned := range steps(step) {
+			if planned == task {
+				return true
+			}
 		}
 	}
-	log.Printf("plan contains %d TaskResolvers", len(plan))
-	return plan, nil
+	return false
 }
 
-func Execute(plan Plan, state *State) (*State, error) {
-	log.Printf("executing plan with %d TaskResolvers", len(plan))
-	for _, task := range plan {
-		_, err := task.Execute(state)
-		if err != nil {
-			return nil, err
-		}
+// steps returns the tasks a plan step runs: the tasks of every branch of a ParallelTask, and the step itself otherwise
+func steps(step Task) []Task {
+	parallel, ok := step.(*ParallelTask)
+	if !ok {
+		return []Task{step}
+	}
+	tasks := make([]Task, 0)
+	for _, branch := range parallel.Branches {
+		tasks = append(tasks, branch...)
+	}
+	return tasks
+}
+
+// extend returns a copy of the Plan with the task appended and its cost added.  The original is left untouched so the
+// planner can backtrack to it.
+func (p *Plan) extend(task Task, cost float64) *Plan {
+	return &Plan{
+		Tasks:   append(p.Tasks[:len(p.Tasks):len(p.Tasks)], task),
+		Cost:    p.Cost + cost,
+		choices: p.choices,
+	}
+}
+
+// choose returns a copy of the Plan that decomposes the task through the method, with the method cost added
+func (p *Plan) choose(task *CompoundTask, method *Method, bindings Bindings, cost float64) *Plan {
+	return &Plan{
+		Tasks:   p.Tasks,
+		Cost:    p.Cost + cost,
+		choices: append(p.choices[:len(p.choices):len(p.choices)], &choice{task: task, method: method, bindings: bindings}),
+	}
+}
+
+// commit tells each compound task which Method the Plan decomposed it through
+func (p *Plan) commit(events Emitter) {
+	for _, c := range p.choices {
+		c.task.commit(c.method, c.bindings)
+		emitTo(events, Event{Type: MethodSelected, Task: c.task.Name(), Method: c.method.Name})
+	}
+}
+
+func (p *Plan) String() string {
+	tasks := make([]string, 0)
+	for _, task := range p.Tasks {
+		tasks = append(tasks, task.Name())
+	}
+	return fmt.Sprintf("plan [%s], cost: %v", strings.Join(tasks, ","), p.Cost)
+}
+
+// Execute runs the Plan against the State, stopping with a PlanInvalidatedError if the world changes in a way that
+// breaks the rest of the plan, or with the error of the context once it is done.  Use an Executor with a Planner to
+// replan instead.
+func Execute(ctx context.Context, plan *Plan, state *State) (*State, error) {
+	executor := &Executor{}
+	_, err := executor.Execute(ctx, plan, state)
+	if err != nil {
+		return nil, err
 	}
 	return state, nil
 }
@@ -0,0 +1,333 @@
+package gohtn
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/logging"
+	"sort"
+	"strings"
+)
+
+// Ordering constrains every subtask named Before to be decomposed ahead of every subtask named After
+type Ordering struct {
+	Before string
+	After  string
+}
+
+func (o Ordering) String() string {
+	return fmt.Sprintf("%s < %s", o.Before, o.After)
+}
+
+// Method is a set of conditions and the subtasks a compound task decomposes into when the conditions are met.  The
+// subtasks are totally ordered unless Ordering or Parallel says otherwise, and may take variable arguments bound by
+// the conditions.
+type Method struct {
+	Conditions    []Condition
+	TaskResolvers TaskResolvers
+	Tasks         []string
+	Ordering      []Ordering
+	Unordered     bool
+	Parallel      bool
+	Join          Join
+	Cost          Cost
+	Score         Utility
+	Weight        float64
+	Name          string
+}
+
+func (m *Method) Applies(state *State) bool {
+	return len(m.Bindings(state)) > 0
+}
+
+// Bindings returns every extension of the State Bindings under which all the conditions are met, in the order the
+// binding conditions produce them.  A Method without variables applies under the State Bindings alone.
+func (m *Method) Bindings(state *State) []Bindings {
+	state.Log().Debug("checking if method applies", logging.Method(m.Name))
+	candidates := []Bindings{state.Bindings}
+	for _, condition := range m.Conditions {
+		next := make([]Bindings, 0)
+		for _, bindings := range candidates {
+			bound := state.Bind(bindings)
+			if binder, ok := condition.(Binder); ok {
+				next = append(next, binder.Bind(bound)...)
+				continue
+			}
+			if isMet(condition, bound) {
+				next = append(next, bindings)
+			}
+		}
+		if len(next) == 0 {
+			state.Log().Debug("method condition not met", logging.Method(m.Name), logging.F("condition", condition.String()))
+			return nil
+		}
+		candidates = next
+	}
+	return candidates
+}
+
+// IsPartiallyOrdered reports whether the subtasks are only constrained by the Ordering
+func (m *Method) IsPartiallyOrdered() bool {
+	return m.Unordered || len(m.Ordering) > 0
+}
+
+// taskNames returns the subtask names in declared order.  Methods assembled without Tasks fall back to the resolver
+// names in lexical order so the decomposition stays deterministic.
+func (m *Method) taskNames() []string {
+	if len(m.Tasks) > 0 {
+		return m.Tasks
+	}
+	names := make([]string, 0)
+	for name := range m.TaskResolvers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Templates resolves the tasks the Method decomposes into, in declared order, without grounding their arguments
+func (m *Method) Templates() ([]Task, error) {
+	tasks := make([]Task, 0)
+	for _, name := range m.taskNames() {
+		taskResolver, ok := m.TaskResolvers[name]
+		if !ok {
+			return nil, fmt.Errorf("method %s task %s has no resolver", m.Name, name)
+		}
+		task, err := taskResolver()
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// Subtasks resolves the tasks the Method decomposes into, in declared order, grounded with the given Bindings
+func (m *Method) Subtasks(bindings Bindings) ([]Task, error) {
+	templates, err := m.Templates()
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(templates))
+	for i, name := range m.taskNames() {
+		_, variables, err := ParseCall(name)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", m.Name, err)
+		}
+		task, err := Ground(templates[i], variables, bindings)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", m.Name, err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// Predecessors returns, for each subtask index, the indices of the subtasks that must be decomposed before it
+func (m *Method) Predecessors() [][]int {
+	names := m.taskNames()
+	predecessors := make([][]int, len(names))
+	for i := range names {
+		predecessors[i] = make([]int, 0)
+		if !m.IsPartiallyOrdered() {
+			if i > 0 {
+				predecessors[i] = append(predecessors[i], i-1)
+			}
+			continue
+		}
+		for _, ordering := range m.Ordering {
+			if ordering.After != names[i] {
+				continue
+			}
+			for j, name := range names {
+				if name == ordering.Before {
+					predecessors[i] = append(predecessors[i], j)
+				}
+			}
+		}
+	}
+	return predecessors
+}
+
+// Linearize returns the subtask indices in an order that satisfies the Ordering constraints, preferring the declared
+// order whenever the constraints allow it.
+func (m *Method) Linearize() ([]int, error) {
+	predecessors := m.Predecessors()
+	done := make([]bool, len(predecessors))
+	order := make([]int, 0, len(predecessors))
+	for len(order) < len(predecessors) {
+		next := -1
+		for i := range predecessors {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, predecessor := range predecessors[i] {
+				if !done[predecessor] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, fmt.Errorf("method %s ordering constraints contain a cycle", m.Name)
+		}
+		done[next] = true
+		order = append(order, next)
+	}
+	return order, nil
+}
+
+// Validate checks that every subtask has a resolver and that the Ordering constraints name declared subtasks and can
+// be satisfied.
+func (m *Method) Validate() error {
+	names := make(map[string]bool)
+	for _, name := range m.taskNames() {
+		if _, ok := m.TaskResolvers[name]; !ok {
+			return fmt.Errorf("method %s task %s has no resolver", m.Name, name)
+		}
+		_, _, err := ParseCall(name)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", m.Name, err)
+		}
+		names[name] = true
+	}
+	for _, ordering := range m.Ordering {
+		if !names[ordering.Before] || !names[ordering.After] {
+			return fmt.Errorf("method %s ordering {%s} names an undeclared task", m.Name, ordering.String())
+		}
+	}
+	if m.Parallel && len(m.Ordering) > 0 {
+		return fmt.Errorf("method %s runs its tasks in parallel and can not declare an ordering", m.Name)
+	}
+	err := m.Join.Validate()
+	if err != nil {
+		return fmt.Errorf("method %s: %w", m.Name, err)
+	}
+	if m.Weight < 0 {
+		return fmt.Errorf("method %s weight %v is negative", m.Name, m.Weight)
+	}
+	_, err = m.Linearize()
+	return err
+}
+
+// Execute runs the subtasks in order and returns the status of the Method.  Execution stops at the first subtask
+// that does not succeed, so a Running subtask leaves the Method Running and is resumed by the next execution.  The
+// subtasks are grounded with the State Bindings.  A Parallel Method runs each subtask on a branch of its own.
+func (m *Method) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	state.Log().Debug("executing method", logging.Method(m.Name))
+	tasks, err := m.Subtasks(state.Bindings)
+	if err != nil {
+		return Failed, err
+	}
+	if m.Parallel {
+		return m.parallel(tasks).Execute(ctx, state)
+	}
+	order, err := m.Linearize()
+	if err != nil {
+		return Failed, err
+	}
+	for _, i := range order {
+		task := tasks[i]
+		if task.IsComplete() {
+			continue
+		}
+		state.Log().Debug("method task not complete, executing it", logging.Method(m.Name), logging.Task(task.Name()))
+		status, err := task.Execute(ctx, state)
+		if err != nil {
+			return Failed, err
+		}
+		if status != Succeeded {
+			return status, nil
+		}
+	}
+	return Succeeded, nil
+}
+
+// status derives the status of the Method from its subtasks grounded with the Bindings.  It has Succeeded once every
+// subtask has, or any of them for a JoinAny parallel Method, and Failed or been Cancelled once a subtask has.  It is
+// Running once some subtask has started, and Pending before.
+func (m *Method) status(bindings Bindings, evaluating map[*CompoundTask]bool) TaskStatus {
+	tasks, err := m.Subtasks(bindings)
+	if err != nil {
+		return Failed
+	}
+	counts := make(map[TaskStatus]int)
+	for _, task := range tasks {
+		if compound, ok := task.(*CompoundTask); ok {
+			counts[compound.status(evaluating)]++
+			continue
+		}
+		counts[task.Status()]++
+	}
+	if m.Parallel && m.Join == JoinAny {
+		switch {
+		case len(tasks) == 0 || counts[Succeeded] > 0:
+			return Succeeded
+		case counts[Failed] > 0 && counts[Failed]+counts[Cancelled] == len(tasks):
+			return Failed
+		case counts[Cancelled] == len(tasks):
+			return Cancelled
+		}
+	} else {
+		switch {
+		case counts[Failed] > 0:
+			return Failed
+		case counts[Cancelled] > 0:
+			return Cancelled
+		case counts[Succeeded] == len(tasks):
+			return Succeeded
+		}
+	}
+	if counts[Pending] == len(tasks) {
+		return Pending
+	}
+	return Running
+}
+
+// parallel returns a ParallelTask running each of the tasks on a branch of its own
+func (m *Method) parallel(tasks []Task) *ParallelTask {
+	branches := make([][]Task, 0, len(tasks))
+	for _, task := range tasks {
+		branches = append(branches, []Task{task})
+	}
+	return &ParallelTask{TaskName: m.Name, Join: m.Join, Branches: branches}
+}
+
+// Cancel cancels any subtask of the Method that is still Running, including every grounded instance
+func (m *Method) Cancel() {
+	tasks, err := m.Templates()
+	if err != nil {
+		return
+	}
+	for _, task := range tasks {
+		for _, instance := range Instances(task) {
+			instance.Cancel()
+		}
+	}
+}
+
+func (m *Method) String() string {
+	conditions := make([]string, 0)
+	for _, condition := range m.Conditions {
+		conditions = append(conditions, fmt.Sprintf("{%s}", condition.String()))
+	}
+	tasks := make([]string, 0)
+	for _, taskName := range m.taskNames() {
+		tasks = append(tasks, fmt.Sprintf("{%s}", taskName))
+	}
+	ordering := "total"
+	if m.Parallel {
+		ordering = fmt.Sprintf("parallel, join %s", m.Join.orAll())
+	} else if m.IsPartiallyOrdered() {
+		constraints := make([]string, 0)
+		for _, constraint := range m.Ordering {
+			constraints = append(constraints, constraint.String())
+		}
+		ordering = fmt.Sprintf("partial [%s]", strings.Join(constraints, ", "))
+	}
+	return fmt.Sprintf("Method %s:\n  conditions: \n   %s\n  tasks: \n   %s\n  ordering: %s\n  cost: %s\n  score: %s", m.Name, strings.Join(conditions, ",\n   "), strings.Join(tasks, ",\n   "), ordering, m.Cost.String(), m.Score.String())
+}
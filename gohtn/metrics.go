@@ -0,0 +1,94 @@
+package gohtn
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	// MetricPlansBuilt counts the plans the Planner has built
+	MetricPlansBuilt = "gohtn_plans_built_total"
+	// MetricPlanningFailures counts the calls to Plan that returned an error
+	MetricPlanningFailures = "gohtn_planning_failures_total"
+	// MetricPlanLength observes the number of steps of each plan built
+	MetricPlanLength = "gohtn_plan_length"
+	// MetricPlanningSeconds observes how long each call to Plan took, in seconds
+	MetricPlanningSeconds = "gohtn_planning_duration_seconds"
+	// MetricConditionEvaluations counts the conditions evaluated while planning and executing, labelled by whether the
+	// condition was met
+	MetricConditionEvaluations = "gohtn_condition_evaluations_total"
+	// MetricMethodSelections counts the methods selected by compound tasks, labelled by task and method
+	MetricMethodSelections = "gohtn_method_selections_total"
+	// MetricTaskResults counts the tasks that finished an execution, labelled by task and status
+	MetricTaskResults = "gohtn_task_results_total"
+)
+
+// Labels qualify a metric, e.g. the task a result is counted for
+type Labels map[string]string
+
+// Metrics is the sink of the statistics collected by the Planner and the Executor.  Add adds to a counter and Observe
+// records a sample of a histogram.  Metrics may be called from several goroutines at once when tasks run in parallel.
+type Metrics interface {
+	Add(name string, labels Labels, delta float64)
+	Observe(name string, labels Labels, value float64)
+}
+
+// WithMetrics returns a view of the State whose condition evaluations are counted in the Metrics
+func (s *State) WithMetrics(metrics Metrics) *State {
+	view := s.Bind(s.Bindings)
+	view.Metrics = metrics
+	return view
+}
+
+// isMet evaluates the condition, counting the evaluation in the Metrics of the State
+func isMet(condition Condition, state *State) bool {
+	met := condition.IsMet(state)
+	if state.Metrics != nil {
+		state.Metrics.Add(MetricConditionEvaluations, Labels{"met": strconv.FormatBool(met)}, 1)
+	}
+	return met
+}
+
+// observePlanning records the outcome of a call to Plan that started at the given time
+func observePlanning(metrics Metrics, started time.Time, plan *Plan, err error) {
+	if metrics == nil {
+		return
+	}
+	metrics.Observe(MetricPlanningSeconds, nil, time.Since(started).Seconds())
+	if err != nil {
+		metrics.Add(MetricPlanningFailures, nil, 1)
+		return
+	}
+	metrics.Add(MetricPlansBuilt, nil, 1)
+	metrics.Observe(MetricPlanLength, nil, float64(len(plan.Tasks)))
+}
+
+// metricsEmitter counts the method selections and task results among the events it forwards
+type metricsEmitter struct {
+	metrics Metrics
+	next    Emitter
+}
+
+// countEvents returns an Emitter that counts events in the Metrics before forwarding them to the Emitter
+func countEvents(events Emitter, metrics Metrics) Emitter {
+	if metrics == nil {
+		return events
+	}
+	return &metricsEmitter{metrics: metrics, next: events}
+}
+
+func (m *metricsEmitter) Emit(event Event) {
+	switch event.Type {
+	case MethodSelected:
+		m.metrics.Add(MetricMethodSelections, Labels{"task": event.Task, "method": event.Method}, 1)
+	case TaskCompleted:
+		m.metrics.Add(MetricTaskResults, Labels{"task": event.Task, "status": string(Succeeded)}, 1)
+	case TaskFailed:
+		m.metrics.Add(MetricTaskResults, Labels{"task": event.Task, "status": string(Failed)}, 1)
+	case TaskCancelled:
+		m.metrics.Add(MetricTaskResults, Labels{"task": event.Task, "status": string(Cancelled)}, 1)
+	}
+	if m.next != nil {
+		m.next.Emit(event)
+	}
+}
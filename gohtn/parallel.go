@@ -0,0 +1,213 @@
+package gohtn
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/logging"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Join string
+
+const (
+	// JoinAll succeeds once every branch has succeeded, and fails once a branch has failed and the others have finished
+	JoinAll Join = "all"
+	// JoinAny succeeds as soon as one branch succeeds, cancelling the others, and fails once every branch has failed
+	JoinAny Join = "any"
+	// JoinFirstFailure succeeds once every branch has succeeded, and fails as soon as one fails, cancelling the others
+	JoinFirstFailure Join = "firstFailure"
+)
+
+func (j Join) Validate() error {
+	switch j {
+	case "", JoinAll, JoinAny, JoinFirstFailure:
+		return nil
+	}
+	return fmt.Errorf("unknown join %s", j)
+}
+
+func (j Join) orAll() Join {
+	if j == "" {
+		return JoinAll
+	}
+	return j
+}
+
+// ParallelTask runs branches of tasks concurrently on a synchronized view of the State, each branch in order, and
+// succeeds or fails according to its Join.  Branch errors are aggregated into a ParallelError.  The view only guards
+// lookups and effects, so the actions of the branches must make their own changes through State.Update.
+type ParallelTask struct {
+	TaskName   string
+	Join       Join
+	Branches   [][]Task
+	TaskStatus TaskStatus
+}
+
+// branchResult is the outcome of one execution of a branch
+type branchResult struct {
+	status TaskStatus
+	err    error
+}
+
+func (p *ParallelTask) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	logger := state.Log().With(logging.Task(p.Name()))
+	logger.Debug("executing parallel task", logging.F("branches", len(p.Branches)), logging.F("join", p.Join.orAll()))
+	shared := state.Synchronized()
+	results := make([]branchResult, len(p.Branches))
+	branchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := &atomic.Bool{}
+	wg := sync.WaitGroup{}
+	for i, branch := range p.Branches {
+		wg.Add(1)
+		go func(i int, branch []Task) {
+			defer wg.Done()
+			status, err := p.runBranch(branchCtx, branch, shared)
+			results[i] = branchResult{status: status, err: err}
+			if (status == Failed && p.Join == JoinFirstFailure) || (status == Succeeded && p.Join == JoinAny) {
+				stop.Store(true)
+				cancel()
+			}
+		}(i, branch)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		logger.Info("parallel task cancelled", logging.Err(ctx.Err()))
+		p.cancelBranches()
+		p.TaskStatus = Cancelled
+		return p.TaskStatus, ctx.Err()
+	}
+	status, errs := p.join(results)
+	if stop.Load() {
+		logger.Debug("join decided, cancelling the remaining branches", logging.F("status", status))
+		p.cancelBranches()
+	}
+	p.TaskStatus = status
+	if len(errs) > 0 {
+		err := &ParallelError{Task: p.Name(), Errors: errs}
+		if status == Failed {
+			return p.TaskStatus, err
+		}
+		logger.Warn("parallel task finished despite failed branches", logging.F("status", status), logging.Err(err))
+	}
+	return p.TaskStatus, nil
+}
+
+// runBranch executes the incomplete tasks of the branch in order.  Once the context is cancelled, because another
+// branch has decided the join, the branch does not start any further task.
+func (p *ParallelTask) runBranch(ctx context.Context, branch []Task, state *State) (TaskStatus, error) {
+	for _, task := range branch {
+		if task.IsComplete() {
+			continue
+		}
+		if ctx.Err() != nil {
+			return Cancelled, nil
+		}
+		status, err := task.Execute(ctx, state)
+		if status == Cancelled {
+			return Cancelled, nil
+		}
+		if err != nil {
+			state.Log().Warn("parallel task branch failed", logging.Task(p.Name()), logging.F("branchTask", task.Name()), logging.Err(err))
+			return Failed, fmt.Errorf("task %s: %w", task.Name(), err)
+		}
+		if status != Succeeded {
+			return status, nil
+		}
+	}
+	return Succeeded, nil
+}
+
+// join combines the results of the branches under the Join.  Until the join is decided, the ParallelTask is Running
+// while any branch is, and otherwise takes the status of the first unfinished branch.
+func (p *ParallelTask) join(results []branchResult) (TaskStatus, []error) {
+	errs := make([]error, 0)
+	succeeded, failed, running := 0, 0, 0
+	unfinished := Pending
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+		}
+		switch result.status {
+		case Succeeded:
+			succeeded++
+		case Failed:
+			failed++
+		case Running:
+			running++
+		}
+		if !result.status.IsDone() && unfinished == Pending {
+			unfinished = result.status
+		}
+	}
+	switch p.Join.orAll() {
+	case JoinAny:
+		if succeeded > 0 || len(results) == 0 {
+			return Succeeded, errs
+		}
+		if failed == len(results) {
+			return Failed, errs
+		}
+	case JoinFirstFailure:
+		if failed > 0 {
+			return Failed, errs
+		}
+	default:
+		if failed > 0 && running == 0 {
+			return Failed, errs
+		}
+	}
+	if succeeded == len(results) {
+		return Succeeded, errs
+	}
+	if running > 0 {
+		return Running, errs
+	}
+	return unfinished, errs
+}
+
+func (p *ParallelTask) cancelBranches() {
+	for _, branch := range p.Branches {
+		for _, task := range branch {
+			task.Cancel()
+		}
+	}
+}
+
+func (p *ParallelTask) Status() TaskStatus {
+	return p.TaskStatus.orPending()
+}
+
+func (p *ParallelTask) IsComplete() bool {
+	return p.Status() == Succeeded
+}
+
+func (p *ParallelTask) Cancel() {
+	p.cancelBranches()
+	if p.Status() == Running {
+		p.TaskStatus = Cancelled
+	}
+}
+
+// Reset returns the ParallelTask to Pending.  The tasks of the branches follow their own reset policies.
+func (p *ParallelTask) Reset() {
+	p.TaskStatus = Pending
+}
+
+func (p *ParallelTask) Name() string {
+	return p.TaskName
+}
+
+func (p *ParallelTask) String() string {
+	branches := make([]string, 0, len(p.Branches))
+	for _, branch := range p.Branches {
+		names := make([]string, 0, len(branch))
+		for _, task := range branch {
+			names = append(names, task.Name())
+		}
+		branches = append(branches, fmt.Sprintf("[%s]", strings.Join(names, ",")))
+	}
+	return fmt.Sprintf("parallel %s join %s: %s, status: %s", p.Name(), p.Join.orAll(), strings.Join(branches, " | "), p.Status())
+}
@@ -0,0 +1,158 @@
+package gohtn
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// blocking returns a task whose action closes started and runs until its context is cancelled
+func blocking(name string, started chan struct{}) *PrimitiveTask {
+	return &PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			close(started)
+			<-ctx.Done()
+			return Cancelled, nil
+		},
+	}
+}
+
+// after returns a task finishing with the status once started is closed
+func after(name string, started chan struct{}, status TaskStatus, err error) *PrimitiveTask {
+	return &PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			<-started
+			return status, err
+		},
+	}
+}
+
+func TestParallelJoins(t *testing.T) {
+	tests := []struct {
+		name     string
+		join     Join
+		branches []TaskStatus
+		expected TaskStatus
+	}{
+		{name: "all succeed", join: JoinAll, branches: []TaskStatus{Succeeded, Succeeded}, expected: Succeeded},
+		{name: "all with a failure", join: JoinAll, branches: []TaskStatus{Succeeded, Failed}, expected: Failed},
+		{name: "all still running", join: JoinAll, branches: []TaskStatus{Succeeded, Running}, expected: Running},
+		{name: "any with a success", join: JoinAny, branches: []TaskStatus{Failed, Succeeded}, expected: Succeeded},
+		{name: "any all failed", join: JoinAny, branches: []TaskStatus{Failed, Failed}, expected: Failed},
+		{name: "first failure", join: JoinFirstFailure, branches: []TaskStatus{Succeeded, Failed}, expected: Failed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parallel := &ParallelTask{TaskName: "Together", Join: test.join}
+			for i, status := range test.branches {
+				parallel.Branches = append(parallel.Branches, []Task{primitive(string(rune('A'+i)), status)})
+			}
+			status, err := parallel.Execute(context.Background(), newState())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != test.expected {
+				t.Fatalf("expected %s, got %s", test.expected, status)
+			}
+		})
+	}
+}
+
+func TestJoinAnyCancelsTheOtherBranchesOnceOneSucceeds(t *testing.T) {
+	started := make(chan struct{})
+	wait := blocking("Wait", started)
+	parallel := &ParallelTask{TaskName: "Either", Join: JoinAny, Branches: [][]Task{{wait}, {after("Go", started, Succeeded, nil)}}}
+	status, err := parallel.Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != Succeeded || wait.Status() != Cancelled {
+		t.Fatalf("expected the join to succeed and cancel the wait, got %s and %s", status, wait.Status())
+	}
+}
+
+func TestJoinFirstFailureCancelsTheOtherBranches(t *testing.T) {
+	started := make(chan struct{})
+	wait := blocking("Wait", started)
+	broken := after("Break", started, Failed, errors.New("broken"))
+	parallel := &ParallelTask{TaskName: "Both", Join: JoinFirstFailure, Branches: [][]Task{{wait}, {broken}}}
+	status, err := parallel.Execute(context.Background(), newState())
+	var parallelError *ParallelError
+	if !errors.As(err, &parallelError) || len(parallelError.Errors) != 1 {
+		t.Fatalf("expected the branch error, got %v", err)
+	}
+	if status != Failed || wait.Status() != Cancelled {
+		t.Fatalf("expected the join to fail and cancel the wait, got %s and %s", status, wait.Status())
+	}
+}
+
+func TestPlannerBuildsAParallelStepForAParallelMethod(t *testing.T) {
+	together := method("Together", primitive("Sing", Succeeded), primitive("Dance", Succeeded))
+	together.Parallel = true
+	together.Join = JoinAll
+	perform := &CompoundTask{TaskName: "Perform", Methods: []*Method{together}}
+	plan, err := (&Planner{Tasks: graph(perform)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Tasks) != 1 {
+		t.Fatalf("expected a single parallel step, got %v", names(plan.Tasks))
+	}
+	parallel, ok := plan.Tasks[0].(*ParallelTask)
+	if !ok || len(parallel.Branches) != 2 {
+		t.Fatalf("expected a parallel step of two branches, got %v", plan.Tasks[0])
+	}
+	_, err = (&Executor{}).Execute(context.Background(), plan, newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perform.Status() != Succeeded {
+		t.Fatalf("expected the performance to succeed, got %s", perform.Status())
+	}
+}
+
+// counter returns a task whose action increments the property the number of times through State.Update
+func counter(name string, property string, times int) *PrimitiveTask {
+	return &PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			for i := 0; i < times; i++ {
+				err := state.Update(func(state *State) error {
+					count, err := state.Number(property)
+					if err != nil {
+						count = 0
+					}
+					state.Properties[property] = &Property[float64]{Name: property, Value: func(state *State) float64 {
+						return count + 1
+					}}
+					return nil
+				})
+				if err != nil {
+					return Failed, err
+				}
+			}
+			return Succeeded, nil
+		},
+	}
+}
+
+func TestBranchesWritingTheSamePropertyThroughUpdateDoNotRace(t *testing.T) {
+	parallel := &ParallelTask{TaskName: "Tally", Branches: [][]Task{
+		{counter("Left", "Count", 100)},
+		{counter("Right", "Count", 100)},
+	}}
+	state := newState()
+	status, err := parallel.Execute(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := state.Number("Count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != Succeeded || count != 200 {
+		t.Fatalf("expected both branches to count to 200, got %s after %v", status, count)
+	}
+}
@@ -0,0 +1,453 @@
+package gohtn
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/logging"
+	"time"
+)
+
+// DefaultMaxDepth bounds the decomposition depth when the Planner does not specify one.  Methods may list their own
+// compound task as a subtask, so the bound keeps a recursive domain from expanding forever.
+const DefaultMaxDepth = 64
+
+// Planner implements a forward decomposition planner.  Each root Task in the graph is decomposed against a simulated
+// copy of the State into a Plan of primitive tasks, backtracking to the next method or ordering when a decomposition
+// dead-ends.  The Strategy returns the first valid plan, or the cheapest.
+type Planner struct {
+	Tasks    *TaskGraph
+	MaxDepth int
+	Strategy Strategy
+	Events   Emitter
+	Clock    clock.Clock
+	Logger   logging.Logger
+	Metrics  Metrics
+}
+
+type Strategy string
+
+const (
+	FirstFound Strategy = "first"
+	Cheapest   Strategy = "cheapest"
+)
+
+// errPruned rejects a decomposition that is valid but not worth pursuing.  It is not a failure, so it is never
+// reported as an alternative.
+var errPruned = errors.New("decomposition pruned")
+
+// pendingTask is an entry of the task network that remains to be decomposed.  The entry is ready once none of the
+// entries listed in after remain in the network.
+type pendingTask struct {
+	id    int
+	task  Task
+	depth int
+	after []int
+}
+
+func (p *pendingTask) follows(id int) bool {
+	for _, predecessor := range p.after {
+		if predecessor == id {
+			return true
+		}
+	}
+	return false
+}
+
+// continuation receives the plan and simulated state once the whole task network has been decomposed.  Returning a
+// DecompositionError or errPruned rejects the decomposition and causes the planner to backtrack.
+type continuation func(plan *Plan, state *State) error
+
+// search holds the bookkeeping of a single call to Plan, including the cheapest decomposition of the current root
+type search struct {
+	planner   *Planner
+	logger    logging.Logger
+	nextID    int
+	best      *Plan
+	bestState *State
+}
+
+func (p *Planner) maxDepth() int {
+	if p.MaxDepth > 0 {
+		return p.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+func (p *Planner) Plan(state *State) (*Plan, error) {
+	started := time.Now()
+	if p.Logger != nil {
+		state = state.WithLogger(p.Logger)
+	}
+	if p.Metrics != nil {
+		state = state.WithMetrics(p.Metrics)
+	}
+	plan, err := p.build(state)
+	observePlanning(p.Metrics, started, plan, err)
+	return plan, err
+}
+
+// build decomposes the roots of the task network one after the other into a single plan
+func (p *Planner) build(state *State) (*Plan, error) {
+	logger := state.Log()
+	logger.Debug("building plan")
+	plan := &Plan{Tasks: make([]Task, 0)}
+	network, err := p.Tasks.Network()
+	if err != nil {
+		return nil, err
+	}
+	s := &search{planner: p, logger: logger}
+	simulated := state.Clone()
+	failures := make([]*DecompositionError, 0)
+	for _, task := range network {
+		// goals are re-evaluated against the live state every time a plan is built
+		if goal, ok := task.(*GoalTask); ok {
+			goal.Evaluate(state)
+		}
+		if task.IsComplete() || plan.contains(task) {
+			continue
+		}
+		// roots are decomposed independently, so a root that is not ready yet does not block the ones after it
+		root := &pendingTask{id: s.newID(), task: task}
+		s.best, s.bestState = nil, nil
+		err := s.decompose([]*pendingTask{root}, plan, simulated, func(rootPlan *Plan, rootState *State) error {
+			if p.Strategy != Cheapest {
+				plan = rootPlan
+				simulated = rootState
+				return nil
+			}
+			logger.Debug("decomposition found", logging.Task(task.Name()), logging.F("cost", rootPlan.Cost))
+			if s.best == nil || rootPlan.Cost < s.best.Cost {
+				s.best, s.bestState = rootPlan, rootState
+			}
+			// keep searching for a cheaper decomposition
+			return errPruned
+		})
+		if s.best != nil {
+			plan = s.best
+			simulated = s.bestState
+			continue
+		}
+		if err != nil {
+			var decompositionError *DecompositionError
+			if !errors.As(err, &decompositionError) {
+				return nil, err
+			}
+			logger.Debug("task could not be decomposed", logging.Task(task.Name()), logging.Err(err))
+			failures = append(failures, decompositionError)
+		}
+	}
+	if len(plan.Tasks) == 0 && len(failures) > 0 {
+		return nil, &PlanningError{Failures: failures}
+	}
+	logger.Info("plan built", logging.F("plan", plan.String()))
+	events := countEvents(stampEvents(p.Events, p.Clock), p.Metrics)
+	plan.commit(events)
+	emitTo(events, Event{Type: PlanBuilt, Plan: plan})
+	return plan, nil
+}
+
+func (s *search) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+// decompose tries each ready entry of the network in turn, handing the finished plan to the continuation.  A totally
+// ordered network only ever has one ready entry.
+func (s *search) decompose(network []*pendingTask, plan *Plan, state *State, k continuation) error {
+	if len(network) == 0 {
+		return k(plan, state)
+	}
+	var failure error
+	pruned := false
+	for i, pending := range network {
+		if !isReady(pending, network) {
+			continue
+		}
+		rest := make([]*pendingTask, 0, len(network)-1)
+		rest = append(rest, network[:i]...)
+		rest = append(rest, network[i+1:]...)
+		err := s.decomposeTask(pending, rest, plan, state, k)
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errPruned) {
+			pruned = true
+			continue
+		}
+		if !isDecompositionFailure(err) {
+			return err
+		}
+		if failure == nil {
+			failure = err
+		}
+	}
+	if failure != nil {
+		return failure
+	}
+	if pruned {
+		return errPruned
+	}
+	return fmt.Errorf("task network ordering constraints contain a cycle")
+}
+
+// bound rejects a partial plan that can not beat the cheapest decomposition found so far.  Costs are never negative,
+// so the plan can only grow more expensive.
+func (s *search) bound(plan *Plan) error {
+	if s.planner.Strategy == Cheapest && s.best != nil && plan.Cost >= s.best.Cost {
+		return errPruned
+	}
+	return nil
+}
+
+// decomposeTask expands a single ready entry and recurses on the remainder of the network.  Tasks already in the plan
+// are treated as complete.
+func (s *search) decomposeTask(pending *pendingTask, rest []*pendingTask, plan *Plan, state *State, k continuation) error {
+	task := pending.task
+	if pending.depth > s.planner.maxDepth() {
+		return &DecompositionError{Task: task.Name(), Err: ErrMaxDepthExceeded}
+	}
+	if goal, ok := task.(*GoalTask); ok {
+		// a goal is judged by the simulated state, not by its last evaluation.  The search deepens one step at a time
+		// so the shortest sequence of candidates that reaches the goal is found first.
+		var failure error
+		pruned := false
+		for steps := 0; steps <= goal.maxSteps(); steps++ {
+			err := s.achieve(goal, pending, plan, state, steps, func(plan *Plan, state *State) error {
+				return s.decompose(rest, plan, state, k)
+			})
+			if err == nil {
+				return nil
+			}
+			if errors.Is(err, errPruned) {
+				pruned = true
+				continue
+			}
+			if !isDecompositionFailure(err) {
+				return err
+			}
+			failure = err
+		}
+		if pruned {
+			return errPruned
+		}
+		return failure
+	}
+	if task.IsComplete() || plan.contains(task) {
+		return s.decompose(rest, plan, state, k)
+	}
+	s.logger.Debug("decomposing task", logging.Task(task.Name()))
+	if parameterized, ok := task.(Parameterized); ok && len(parameterized.Parameters()) > 0 {
+		return fmt.Errorf("task %s must be grounded with its parameters before it is planned", task.Name())
+	}
+	switch t := task.(type) {
+	case *PrimitiveTask:
+		// a Running task is in flight, so it stays in the plan without checking its preconditions again
+		if t.Status() != Running {
+			bound := state.Bind(t.Arguments)
+			for _, condition := range t.Preconditions {
+				if !isMet(condition, bound) {
+					return &DecompositionError{Task: t.Name(), Err: ErrPreconditionNotMet, Condition: condition.String()}
+				}
+			}
+		}
+		cost, err := t.Cost.Evaluate(state)
+		if err != nil {
+			return fmt.Errorf("task %s: %w", t.Name(), err)
+		}
+		extended := plan.extend(t, cost)
+		err = s.bound(extended)
+		if err != nil {
+			return err
+		}
+		next := state.Clone()
+		err = applyEffects(t.Effects, next)
+		if err != nil {
+			return err
+		}
+		return s.decompose(rest, extended, next, k)
+	case *CompoundTask:
+		alternatives := make([]*MethodFailure, 0)
+		pruned := false
+		bound := state.Bind(t.Arguments)
+		methods, err := t.Rank(bound)
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			// every binding of the method variables is a separate choice to backtrack over
+			for _, bindings := range method.Bindings(bound) {
+				name := method.Name
+				if len(bindings) > 0 {
+					name = fmt.Sprintf("%s{%s}", method.Name, bindings.String())
+				}
+				s.logger.Debug("trying method", logging.Task(t.Name()), logging.Method(name))
+				cost, err := method.Cost.Evaluate(state)
+				if err != nil {
+					return fmt.Errorf("method %s: %w", method.Name, err)
+				}
+				charged := plan.choose(t, method, bindings, cost)
+				err = s.bound(charged)
+				if err == nil {
+					var subtasks []Task
+					subtasks, err = method.Subtasks(bindings)
+					if err != nil {
+						return err
+					}
+					if method.Parallel {
+						err = s.branches(method, pending, subtasks, charged, charged, state, nil, func(plan *Plan, state *State) error {
+							return s.decompose(rest, plan, state, k)
+						})
+					} else {
+						err = s.decompose(s.expand(pending, subtasks, method.Predecessors(), rest), charged, state, k)
+					}
+				}
+				if err == nil {
+					return nil
+				}
+				if errors.Is(err, errPruned) {
+					pruned = true
+					continue
+				}
+				if !isDecompositionFailure(err) {
+					return err
+				}
+				s.logger.Debug("method failed, backtracking", logging.Task(t.Name()), logging.Method(name), logging.Err(err))
+				alternatives = append(alternatives, &MethodFailure{Method: name, Err: err})
+			}
+		}
+		if pruned {
+			return errPruned
+		}
+		if len(alternatives) == 0 {
+			return &DecompositionError{Task: t.Name(), Err: ErrNoApplicableMethod}
+		}
+		return &DecompositionError{Task: t.Name(), Err: ErrMethodsExhausted, Alternatives: alternatives}
+	case *Decorator:
+		if !t.Ready() {
+			return &DecompositionError{Task: t.Name(), Err: ErrCoolingDown}
+		}
+		// the wrapped task is decomposed to check it can run, then replaced in the plan by the decorator as one step
+		entry := &pendingTask{id: s.newID(), task: t.Task, depth: pending.depth + 1}
+		return s.decompose([]*pendingTask{entry}, plan, state, func(decomposed *Plan, next *State) error {
+			decorated := &Plan{
+				Tasks:   append(plan.Tasks[:len(plan.Tasks):len(plan.Tasks)], t),
+				Cost:    decomposed.Cost,
+				choices: decomposed.choices,
+			}
+			return s.decompose(rest, decorated, next, k)
+		})
+	}
+	return fmt.Errorf("task %s has unsupported type %T", task.Name(), task)
+}
+
+// branches decomposes each subtask of a parallel Method into a branch, then replaces the tasks of the branches in the
+// plan by a single ParallelTask.  Branches that are already complete are left out.
+func (s *search) branches(method *Method, pending *pendingTask, subtasks []Task, base *Plan, plan *Plan, state *State, branches [][]Task, k continuation) error {
+	if len(branches) < len(subtasks) {
+		entry := &pendingTask{id: s.newID(), task: subtasks[len(branches)], depth: pending.depth + 1}
+		return s.decompose([]*pendingTask{entry}, plan, state, func(decomposed *Plan, next *State) error {
+			branch := decomposed.Tasks[len(plan.Tasks):]
+			return s.branches(method, pending, subtasks, base, decomposed, next, append(branches[:len(branches):len(branches)], branch), k)
+		})
+	}
+	remaining := make([][]Task, 0, len(branches))
+	for _, branch := range branches {
+		if len(branch) == 0 {
+			if method.Join == JoinAny {
+				return k(&Plan{Tasks: base.Tasks, Cost: plan.Cost, choices: plan.choices}, state)
+			}
+			continue
+		}
+		remaining = append(remaining, branch)
+	}
+	tasks := base.Tasks
+	if len(remaining) > 0 {
+		step := &ParallelTask{TaskName: method.Name, Join: method.Join, Branches: remaining}
+		tasks = append(base.Tasks[:len(base.Tasks):len(base.Tasks)], step)
+	}
+	return k(&Plan{Tasks: tasks, Cost: plan.Cost, choices: plan.choices}, state)
+}
+
+// achieve searches for a sequence of the goal candidates, at most steps long, after which the goal is met in the
+// simulated state.  Candidates are tried in order, so a goal over task conditions plans its tasks in declared order
+// when their preconditions allow it.  The goal is decomposed as a whole, before the rest of the network.
+func (s *search) achieve(goal *GoalTask, pending *pendingTask, plan *Plan, state *State, steps int, k continuation) error {
+	unmet := goal.Unmet(plan, state)
+	if unmet == nil {
+		return k(plan, state)
+	}
+	if steps == 0 {
+		return &DecompositionError{Task: goal.Name(), Err: ErrGoalUnreachable, Condition: unmet.String()}
+	}
+	alternatives := make([]*MethodFailure, 0)
+	pruned := false
+	for _, candidate := range goal.Candidates() {
+		// a candidate that is already done can not make progress towards the goal
+		if candidate.IsComplete() || plan.contains(candidate) {
+			continue
+		}
+		s.logger.Debug("goal trying task", logging.Task(goal.Name()), logging.F("candidate", candidate.Name()))
+		entry := &pendingTask{id: s.newID(), task: candidate, depth: pending.depth + 1}
+		err := s.decompose([]*pendingTask{entry}, plan, state, func(plan *Plan, state *State) error {
+			return s.achieve(goal, pending, plan, state, steps-1, k)
+		})
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, errPruned) {
+			pruned = true
+			continue
+		}
+		if !isDecompositionFailure(err) {
+			return err
+		}
+		alternatives = append(alternatives, &MethodFailure{Method: candidate.Name(), Err: err})
+	}
+	if pruned {
+		return errPruned
+	}
+	return &DecompositionError{Task: goal.Name(), Err: ErrGoalUnreachable, Condition: unmet.String(), Alternatives: alternatives}
+}
+
+// expand replaces a decomposed entry with its subtasks.  The subtasks are placed at the front of the network, carry
+// the given predecessors between themselves, and every entry that had to follow the decomposed task now follows all
+// of its subtasks.
+func (s *search) expand(pending *pendingTask, subtasks []Task, predecessors [][]int, rest []*pendingTask) []*pendingTask {
+	ids := make([]int, len(subtasks))
+	for i := range subtasks {
+		ids[i] = s.newID()
+	}
+	network := make([]*pendingTask, 0, len(subtasks)+len(rest))
+	for i, subtask := range subtasks {
+		after := make([]int, 0)
+		for _, predecessor := range predecessors[i] {
+			after = append(after, ids[predecessor])
+		}
+		network = append(network, &pendingTask{id: ids[i], task: subtask, depth: pending.depth + 1, after: after})
+	}
+	for _, entry := range rest {
+		if !entry.follows(pending.id) {
+			network = append(network, entry)
+			continue
+		}
+		after := make([]int, 0, len(entry.after)+len(ids))
+		for _, predecessor := range entry.after {
+			if predecessor != pending.id {
+				after = append(after, predecessor)
+			}
+		}
+		after = append(after, ids...)
+		network = append(network, &pendingTask{id: entry.id, task: entry.task, depth: entry.depth, after: after})
+	}
+	return network
+}
+
+func isReady(pending *pendingTask, network []*pendingTask) bool {
+	for _, entry := range network {
+		if pending.follows(entry.id) {
+			return false
+		}
+	}
+	return true
+}
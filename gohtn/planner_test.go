@@ -0,0 +1,211 @@
+package gohtn
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// atLeast is met once the numeric property reaches the value
+type atLeast struct {
+	property string
+	value    float64
+}
+
+func (a *atLeast) IsMet(state *State) bool {
+	value, err := state.Number(a.property)
+	return err == nil && value >= a.value
+}
+
+func (a *atLeast) String() string {
+	return fmt.Sprintf("%s >= %v", a.property, a.value)
+}
+
+// setting returns a task that succeeds and sets the property to one
+func setting(name string, property string) *PrimitiveTask {
+	task := primitive(name, Succeeded)
+	task.Effects = []*Effect{{Operation: SetProperty, Property: property, Value: 1}}
+	return task
+}
+
+// requiring returns a task that succeeds once the property is set
+func requiring(name string, property string) *PrimitiveTask {
+	task := primitive(name, Succeeded)
+	task.Preconditions = []Condition{&atLeast{property: property, value: 1}}
+	return task
+}
+
+func names(tasks []Task) []string {
+	names := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		names = append(names, task.Name())
+	}
+	return names
+}
+
+func expectPlan(t *testing.T, plan *Plan, expected ...string) {
+	t.Helper()
+	actual := names(plan.Tasks)
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Fatalf("expected the plan %v, got %v", expected, actual)
+	}
+}
+
+func TestPlannerBacktracksToTheMostRecentChoice(t *testing.T) {
+	prepare := &CompoundTask{TaskName: "Prepare", Methods: []*Method{
+		method("Quick", primitive("Cook", Succeeded)),
+		method("Slow", setting("Bake", "Ready")),
+	}}
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{
+		method("Deliver", prepare, requiring("Deliver", "Ready")),
+		method("Apologize", primitive("Apologize", Succeeded)),
+	}}
+	plan, err := (&Planner{Tasks: graph(serve)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Bake", "Deliver")
+	if prepare.selected.Name != "Slow" || serve.selected.Name != "Deliver" {
+		t.Fatalf("expected the plan to commit Slow and Deliver, got %s and %s", prepare.selected.Name, serve.selected.Name)
+	}
+}
+
+func TestPlannerFallsBackToTheNextMethod(t *testing.T) {
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{
+		method("Deliver", primitive("Cook", Succeeded), requiring("Deliver", "Ready")),
+		method("Apologize", primitive("Apologize", Succeeded)),
+	}}
+	plan, err := (&Planner{Tasks: graph(serve)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Apologize")
+}
+
+func TestPlannerReportsATaskWithNoValidDecomposition(t *testing.T) {
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{
+		method("Deliver", primitive("Cook", Succeeded), requiring("Deliver", "Ready")),
+	}}
+	_, err := (&Planner{Tasks: graph(serve)}).Plan(newState())
+	var planningError *PlanningError
+	if !errors.As(err, &planningError) || len(planningError.Failures) != 1 {
+		t.Fatalf("expected a planning error for the serve task, got %v", err)
+	}
+}
+
+func TestPlannerOrdersTheSubtasksOfAnUnorderedMethod(t *testing.T) {
+	deliver := requiring("Deliver", "Ready")
+	bake := setting("Bake", "Ready")
+	bake.Preconditions = []Condition{&atLeast{property: "Clean", value: 1}}
+	wash := setting("Wash", "Clean")
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{method("Deliver", deliver, bake, wash)}}
+	serve.Methods[0].Unordered = true
+	plan, err := (&Planner{Tasks: graph(serve)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Wash", "Bake", "Deliver")
+}
+
+func TestPlannerKeepsTheOrderingConstraints(t *testing.T) {
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{
+		method("Deliver", requiring("Deliver", "Ready"), setting("Bake", "Ready"), primitive("Wash", Succeeded)),
+	}}
+	serve.Methods[0].Ordering = []Ordering{{Before: "Bake", After: "Deliver"}, {Before: "Deliver", After: "Wash"}}
+	plan, err := (&Planner{Tasks: graph(serve)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Bake", "Deliver", "Wash")
+
+	serve.Methods[0].Ordering = []Ordering{{Before: "Deliver", After: "Bake"}}
+	_, err = (&Planner{Tasks: graph(serve)}).Plan(newState())
+	if err == nil {
+		t.Fatal("expected no plan delivering before baking")
+	}
+}
+
+// travel returns a task reaching the market on foot at a cost scaled by the distance, or by cart at a fixed cost
+func travel() *CompoundTask {
+	walk := primitive("Walk", Succeeded)
+	walk.Cost = Cost{Property: "Distance", Scale: 2}
+	cart := primitive("Ride", Succeeded)
+	cart.Cost = Cost{Value: 1}
+	byCart := method("ByCart", cart)
+	byCart.Cost = Cost{Value: 4}
+	return &CompoundTask{TaskName: "Travel", Methods: []*Method{method("OnFoot", walk), byCart}}
+}
+
+func TestCheapestPlan(t *testing.T) {
+	tests := []struct {
+		distance float64
+		strategy Strategy
+		expected string
+		cost     float64
+	}{
+		{distance: 5, strategy: FirstFound, expected: "Walk", cost: 10},
+		{distance: 5, strategy: Cheapest, expected: "Ride", cost: 5},
+		{distance: 1, strategy: Cheapest, expected: "Walk", cost: 2},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s %v", test.strategy, test.distance), func(t *testing.T) {
+			state := newState()
+			err := (&Effect{Operation: SetProperty, Property: "Distance", Value: test.distance}).Apply(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan, err := (&Planner{Tasks: graph(travel()), Strategy: test.strategy}).Plan(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectPlan(t, plan, test.expected)
+			if plan.Cost != test.cost {
+				t.Fatalf("expected the plan to cost %v, got %v", test.cost, plan.Cost)
+			}
+		})
+	}
+}
+
+// readyGoal returns a goal to have the property Ready set, reached by washing and then baking
+func readyGoal(maxSteps int) *GoalTask {
+	bake := setting("Bake", "Ready")
+	bake.Preconditions = []Condition{&atLeast{property: "Clean", value: 1}}
+	return &GoalTask{
+		TaskName:      "BeReady",
+		Preconditions: []Condition{&atLeast{property: "Ready", value: 1}},
+		Tasks:         []Task{bake, primitive("Sweep", Succeeded), setting("Wash", "Clean")},
+		MaxSteps:      maxSteps,
+	}
+}
+
+func TestPlannerSearchesForTasksMeetingTheGoal(t *testing.T) {
+	plan, err := (&Planner{Tasks: graph(readyGoal(0))}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan, "Wash", "Bake")
+}
+
+func TestPlannerReportsAGoalOutOfReach(t *testing.T) {
+	_, err := (&Planner{Tasks: graph(readyGoal(1))}).Plan(newState())
+	if !errors.Is(err, ErrGoalUnreachable) {
+		t.Fatalf("expected the goal to be out of reach in one step, got %v", err)
+	}
+}
+
+func TestPlannerPlansNothingForAGoalAlreadyMet(t *testing.T) {
+	state := newState()
+	err := (&Effect{Operation: SetProperty, Property: "Ready", Value: 1}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goal := readyGoal(0)
+	plan, err := (&Planner{Tasks: graph(goal)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPlan(t, plan)
+	if goal.Evaluate(state) != Succeeded {
+		t.Fatalf("expected the goal to have succeeded, got %s", goal.Evaluate(state))
+	}
+}
@@ -0,0 +1,129 @@
+package gohtn
+
+import "fmt"
+
+type ResetType string
+
+const (
+	ResetNever       ResetType = "never"
+	ResetOnSuccess   ResetType = "onSuccess"
+	ResetAfterTicks  ResetType = "afterTicks"
+	ResetOnCondition ResetType = "onCondition"
+)
+
+// ResetPolicy decides when a finished Task returns to Pending so it can run again.  Each task instance needs its own
+// policy, since the policy remembers when the task finished.
+type ResetPolicy struct {
+	Type       ResetType
+	Ticks      int64
+	Condition  Condition
+	finished   bool
+	finishedAt int64
+}
+
+// Clone returns a copy of the policy for another task instance, without the finished state of this one
+func (p *ResetPolicy) Clone() *ResetPolicy {
+	if p == nil {
+		return nil
+	}
+	return &ResetPolicy{
+		Type:      p.Type,
+		Ticks:     p.Ticks,
+		Condition: p.Condition,
+	}
+}
+
+// Repeatable is implemented by tasks that carry a ResetPolicy
+type Repeatable interface {
+	Task
+	Policy() *ResetPolicy
+}
+
+func (p *ResetPolicy) Validate() error {
+	switch p.Type {
+	case ResetNever, ResetOnSuccess:
+	case ResetAfterTicks:
+		if p.Ticks <= 0 {
+			return fmt.Errorf("reset policy %s requires a positive tick count", p.Type)
+		}
+	case ResetOnCondition:
+		if p.Condition == nil {
+			return fmt.Errorf("reset policy %s requires a condition", p.Type)
+		}
+	default:
+		return fmt.Errorf("unknown reset policy %s", p.Type)
+	}
+	return nil
+}
+
+// Apply resets the task when the policy calls for it at the given tick, and reports whether it did
+func (p *ResetPolicy) Apply(task Task, state *State, tick int64) bool {
+	status := task.Status()
+	if !status.IsDone() {
+		p.finished = false
+		return false
+	}
+	if !p.finished {
+		p.finished = true
+		p.finishedAt = tick
+	}
+	reset := false
+	switch p.Type {
+	case ResetOnSuccess:
+		reset = status == Succeeded
+	case ResetAfterTicks:
+		reset = tick-p.finishedAt >= p.Ticks
+	case ResetOnCondition:
+		reset = p.Condition != nil && isMet(p.Condition, state)
+	}
+	if reset {
+		task.Reset()
+		p.finished = false
+	}
+	return reset
+}
+
+func (p *ResetPolicy) String() string {
+	switch p.Type {
+	case ResetAfterTicks:
+		return fmt.Sprintf("%s %d", p.Type, p.Ticks)
+	case ResetOnCondition:
+		return fmt.Sprintf("%s {%s}", p.Type, p.Condition.String())
+	}
+	return string(p.Type)
+}
+
+// ApplyResetPolicy applies the policy of a Repeatable task, reporting whether the task was reset
+func ApplyResetPolicy(task Task, state *State, tick int64) bool {
+	repeatable, ok := task.(Repeatable)
+	if !ok || repeatable.Policy() == nil {
+		return false
+	}
+	return repeatable.Policy().Apply(task, state, tick)
+}
+
+// CancelSubtree cancels the task and every task it can decompose into that is still Running
+func CancelSubtree(task Task) error {
+	tasks, err := Subtree(task)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if t.Status() == Running {
+			t.Cancel()
+		}
+	}
+	return nil
+}
+
+// ResetSubtree returns the task and every task it can decompose into to Pending, regardless of their policies
+func ResetSubtree(task Task) error {
+	tasks, err := Subtree(task)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		t.Reset()
+	}
+	return nil
+}
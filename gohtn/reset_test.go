@@ -0,0 +1,125 @@
+package gohtn
+
+import (
+	"context"
+	"testing"
+)
+
+// finished returns a task that has run to the status under the policy
+func finished(t *testing.T, status TaskStatus, policy *ResetPolicy) *PrimitiveTask {
+	t.Helper()
+	task := primitive("Greet", status)
+	task.ResetPolicy = policy
+	_, err := task.Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status() != status {
+		t.Fatalf("expected the task to be %s, got %s", status, task.Status())
+	}
+	return task
+}
+
+func TestResetPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ResetPolicy
+		status TaskStatus
+		// resets holds whether the task is reset at each tick from the one it finished on
+		resets []bool
+	}{
+		{name: "never", policy: ResetPolicy{Type: ResetNever}, status: Succeeded, resets: []bool{false, false, false}},
+		{name: "on success", policy: ResetPolicy{Type: ResetOnSuccess}, status: Succeeded, resets: []bool{true}},
+		{name: "on success after a failure", policy: ResetPolicy{Type: ResetOnSuccess}, status: Failed, resets: []bool{false, false}},
+		{name: "after ticks", policy: ResetPolicy{Type: ResetAfterTicks, Ticks: 2}, status: Succeeded, resets: []bool{false, false, true}},
+		{name: "after ticks after a failure", policy: ResetPolicy{Type: ResetAfterTicks, Ticks: 1}, status: Failed, resets: []bool{false, true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := test.policy
+			task := finished(t, test.status, &policy)
+			for tick, expected := range test.resets {
+				if reset := ApplyResetPolicy(task, newState(), int64(tick)); reset != expected {
+					t.Fatalf("tick %d: expected the reset to be %t, got %t", tick, expected, reset)
+				}
+			}
+			last := test.resets[len(test.resets)-1]
+			if last != (task.Status() == Pending) {
+				t.Fatalf("expected the task to be reset %t, got %s", last, task.Status())
+			}
+		})
+	}
+}
+
+func TestResetOnConditionWaitsForTheCondition(t *testing.T) {
+	condition := &FlagCondition{}
+	task := finished(t, Succeeded, &ResetPolicy{Type: ResetOnCondition, Condition: condition})
+	if ApplyResetPolicy(task, newState(), 0) {
+		t.Fatal("expected the task not to be reset before the condition is met")
+	}
+	condition.Set(true)
+	if !ApplyResetPolicy(task, newState(), 1) || task.Status() != Pending {
+		t.Fatalf("expected the task to be reset once the condition is met, got %s", task.Status())
+	}
+}
+
+func TestAfterTicksCountsFromTheLatestFinish(t *testing.T) {
+	policy := &ResetPolicy{Type: ResetAfterTicks, Ticks: 2}
+	task := finished(t, Succeeded, policy)
+	ApplyResetPolicy(task, newState(), 0)
+	task.Reset()
+	ApplyResetPolicy(task, newState(), 1)
+	_, err := task.Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ApplyResetPolicy(task, newState(), 3) {
+		t.Fatal("expected the ticks to be counted from the second finish")
+	}
+	if !ApplyResetPolicy(task, newState(), 5) {
+		t.Fatal("expected the task to be reset two ticks after the second finish")
+	}
+}
+
+func TestResetPolicyValidation(t *testing.T) {
+	invalid := []*ResetPolicy{
+		{Type: ResetAfterTicks},
+		{Type: ResetOnCondition},
+		{Type: "sometimes"},
+	}
+	for _, policy := range invalid {
+		if policy.Validate() == nil {
+			t.Errorf("expected the policy %s to be rejected", policy.Type)
+		}
+	}
+	if err := (&ResetPolicy{Type: ResetAfterTicks, Ticks: 1}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResetSubtreeReturnsEveryTaskToPending(t *testing.T) {
+	greet := primitive("Greet", Succeeded)
+	trade := primitive("Trade", Failed)
+	serve := &CompoundTask{TaskName: "Serve", Methods: []*Method{method("Serve", greet, trade)}}
+	state := newState()
+	plan, err := (&Planner{Tasks: graph(serve)}).Plan(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Executor{}).Execute(context.Background(), plan, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if greet.Status() != Succeeded || trade.Status() != Failed || serve.Status() != Failed {
+		t.Fatalf("expected the serve to fail at the trade, got %s, %s and %s", serve.Status(), greet.Status(), trade.Status())
+	}
+	err = ResetSubtree(serve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []Task{serve, greet, trade} {
+		if task.Status() != Pending {
+			t.Fatalf("expected %s to be pending, got %s", task.Name(), task.Status())
+		}
+	}
+}
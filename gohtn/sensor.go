@@ -3,7 +3,8 @@ package gohtn
 import (
 	"fmt"
 	"github.com/cory-johannsen/gohtn/actor"
-	"log"
+	"github.com/cory-johannsen/gohtn/clock"
+	"github.com/cory-johannsen/gohtn/logging"
 	"time"
 )
 
@@ -40,14 +41,17 @@ func (s *SimpleSensor) String() string {
 
 var _ Sensor[float64] = &SimpleSensor{}
 
-// TickSensor provides the elapsed ticks since engine initialization as an int64
+// TickSensor provides the elapsed ticks since engine initialization as an int64.  The time is read from the Clock, or
+// from the wall clock when it is nil.
 type TickSensor struct {
 	StartedAt    time.Time
 	TickDuration time.Duration
+	Clock        clock.Clock
+	Logger       logging.Logger
 }
 
 func (s *TickSensor) Get() (int64, error) {
-	now := time.Now()
+	now := clock.OrReal(s.Clock).Now()
 	elapsed := now.Sub(s.StartedAt)
 	ticks := elapsed.Nanoseconds() / s.TickDuration.Nanoseconds()
 	return ticks, nil
@@ -70,10 +74,11 @@ type HourOfDaySensor struct {
 }
 
 func (s *HourOfDaySensor) Get() (int64, error) {
-	now := time.Now()
-	elapsed := now.Sub(s.StartedAt)
-	ticks := elapsed.Nanoseconds() / s.TickDuration.Nanoseconds()
-	log.Printf("HourOfDaySensor: tick %d", ticks)
+	ticks, err := s.TickSensor.Get()
+	if err != nil {
+		return 0, err
+	}
+	logging.OrNop(s.Logger).Debug("hour of day sensor", logging.F("ticks", ticks))
 	hour := ticks % 24
 	return hour, nil
 }
@@ -107,6 +112,7 @@ var _ Sensor[int] = &CustomersEngagedSensor{}
 type CustomersInRangeSensor struct {
 	Vendor *actor.Vendor
 	Actors actor.Actors
+	Logger logging.Logger
 }
 
 func (s *CustomersInRangeSensor) Get() (int, error) {
@@ -117,7 +123,7 @@ func (s *CustomersInRangeSensor) Get() (int, error) {
 			continue
 		}
 		distance := actor.Distance(vendorLocation, a.Location())
-		log.Printf("calculated distance to %s is %f", a.Name(), distance)
+		logging.OrNop(s.Logger).Debug("calculated distance", logging.F("actor", a.Name()), logging.F("distance", distance))
 		if distance <= s.Vendor.Range {
 			inRange++
 		}
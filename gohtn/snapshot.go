@@ -0,0 +1,224 @@
+package gohtn
+
+import (
+	"fmt"
+	"time"
+)
+
+// TaskSnapshot records the runtime state of a task instance and of its grounded Instances.  Bound values are recorded
+// by name.
+type TaskSnapshot struct {
+	Name      string             `json:"name"`
+	Status    TaskStatus         `json:"status,omitempty"`
+	Arguments []string           `json:"arguments,omitempty"`
+	Selected  string             `json:"selected,omitempty"`
+	Bindings  map[string]string  `json:"bindings,omitempty"`
+	Last      string             `json:"last,omitempty"`
+	Reset     *ResetSnapshot     `json:"reset,omitempty"`
+	Decorator *DecoratorSnapshot `json:"decorator,omitempty"`
+	Task      *TaskSnapshot      `json:"task,omitempty"`
+	Instances []*TaskSnapshot    `json:"instances,omitempty"`
+}
+
+// ResetSnapshot records whether a task was seen finished by its reset policy, and at which tick
+type ResetSnapshot struct {
+	Finished   bool  `json:"finished,omitempty"`
+	FinishedAt int64 `json:"finishedAt,omitempty"`
+}
+
+// DecoratorSnapshot records the progress of a Decorator: its runs, the tick and time it started and finished at, and
+// the tick a retry is due
+type DecoratorSnapshot struct {
+	Tick        int64     `json:"tick"`
+	Runs        int       `json:"runs,omitempty"`
+	Started     bool      `json:"started,omitempty"`
+	StartedTick int64     `json:"startedTick,omitempty"`
+	StartedAt   time.Time `json:"startedAt,omitempty"`
+	RetryAt     int64     `json:"retryAt,omitempty"`
+	Finished    bool      `json:"finished,omitempty"`
+	FinishTick  int64     `json:"finishTick,omitempty"`
+	FinishedAt  time.Time `json:"finishedAt,omitempty"`
+}
+
+// SnapshotTask records the runtime state of the task and of its grounded instances
+func SnapshotTask(task Task) *TaskSnapshot {
+	snapshot := &TaskSnapshot{Name: task.Name()}
+	switch t := task.(type) {
+	case *PrimitiveTask:
+		snapshot.Status = t.TaskStatus
+	case *CompoundTask:
+		snapshot.Status = t.TaskStatus
+		if t.selected != nil {
+			snapshot.Selected = t.selected.Name
+			snapshot.Bindings = bindingNames(t.bindings)
+		}
+		if t.last != nil {
+			snapshot.Last = t.last.Name
+		}
+	case *Decorator:
+		snapshot.Status = t.TaskStatus
+		snapshot.Decorator = &DecoratorSnapshot{
+			Tick:        t.tick,
+			Runs:        t.runs,
+			Started:     t.started,
+			StartedTick: t.startedTick,
+			StartedAt:   t.startedAt,
+			RetryAt:     t.retryAt,
+			Finished:    t.finished,
+			FinishTick:  t.finishTick,
+			FinishedAt:  t.finishedAt,
+		}
+		snapshot.Task = SnapshotTask(t.Task)
+	}
+	// a decorator shares the reset policy of the task it wraps
+	if repeatable, ok := task.(Repeatable); ok && repeatable.Policy() != nil && snapshot.Task == nil {
+		policy := repeatable.Policy()
+		if policy.finished {
+			snapshot.Reset = &ResetSnapshot{Finished: policy.finished, FinishedAt: policy.finishedAt}
+		}
+	}
+	if parameterized, ok := task.(Parameterized); ok && len(parameterized.Parameters()) > 0 {
+		for _, instance := range parameterized.Instances() {
+			instanceSnapshot := SnapshotTask(instance)
+			instanceSnapshot.Arguments = argumentNames(parameterized.Parameters(), boundArguments(instance))
+			snapshot.Instances = append(snapshot.Instances, instanceSnapshot)
+		}
+	}
+	return snapshot
+}
+
+// RestoreTask brings the task back to the state recorded by the snapshot, grounding the instances it records.  Bound
+// values are resolved by name against the actors of the State.  Goal tasks have no state of their own, since they are
+// evaluated against the State every time they are planned.
+func RestoreTask(task Task, snapshot *TaskSnapshot, state *State) error {
+	if snapshot.Name != task.Name() {
+		return fmt.Errorf("snapshot of task %s can not be restored to task %s", snapshot.Name, task.Name())
+	}
+	switch t := task.(type) {
+	case *PrimitiveTask:
+		t.TaskStatus = snapshot.Status
+	case *CompoundTask:
+		t.TaskStatus = snapshot.Status
+		t.selected, t.bindings, t.last = nil, nil, nil
+		if len(snapshot.Selected) > 0 {
+			method, err := t.method(snapshot.Selected)
+			if err != nil {
+				return err
+			}
+			t.selected = method
+			t.bindings = resolveBindings(snapshot.Bindings, state)
+		}
+		if len(snapshot.Last) > 0 {
+			method, err := t.method(snapshot.Last)
+			if err != nil {
+				return err
+			}
+			t.last = method
+		}
+	case *Decorator:
+		t.TaskStatus = snapshot.Status
+		if d := snapshot.Decorator; d != nil {
+			t.tick, t.runs, t.retryAt = d.Tick, d.Runs, d.RetryAt
+			t.started, t.startedTick, t.startedAt = d.Started, d.StartedTick, d.StartedAt
+			t.finished, t.finishTick, t.finishedAt = d.Finished, d.FinishTick, d.FinishedAt
+		}
+		if snapshot.Task != nil {
+			err := RestoreTask(t.Task, snapshot.Task, state)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if repeatable, ok := task.(Repeatable); ok && repeatable.Policy() != nil && snapshot.Task == nil {
+		policy := repeatable.Policy()
+		policy.finished, policy.finishedAt = false, 0
+		if snapshot.Reset != nil {
+			policy.finished, policy.finishedAt = snapshot.Reset.Finished, snapshot.Reset.FinishedAt
+		}
+	}
+	for _, instanceSnapshot := range snapshot.Instances {
+		arguments := make([]any, 0, len(instanceSnapshot.Arguments))
+		for _, name := range instanceSnapshot.Arguments {
+			arguments = append(arguments, resolveArgument(name, state))
+		}
+		parameterized, ok := task.(Parameterized)
+		if !ok {
+			return fmt.Errorf("task %s does not take parameters", task.Name())
+		}
+		instance, err := parameterized.Ground(arguments)
+		if err != nil {
+			return err
+		}
+		err = RestoreTask(instance, instanceSnapshot, state)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// method returns the named method of the compound task
+func (c *CompoundTask) method(name string) (*Method, error) {
+	for _, method := range c.Methods {
+		if method.Name == name {
+			return method, nil
+		}
+	}
+	return nil, fmt.Errorf("task %s has no method %s", c.Name(), name)
+}
+
+// boundArguments returns the arguments a grounded instance is bound to, which for a decorator are those of the task it
+// wraps
+func boundArguments(task Task) Bindings {
+	switch t := task.(type) {
+	case *PrimitiveTask:
+		return t.Arguments
+	case *CompoundTask:
+		return t.Arguments
+	case *Decorator:
+		return boundArguments(t.Task)
+	}
+	return nil
+}
+
+// argumentNames names the arguments of a grounded instance in the order of the parameters of the task it grounds
+func argumentNames(parameters []string, arguments Bindings) []string {
+	if arguments == nil {
+		return nil
+	}
+	names := make([]string, 0, len(parameters))
+	for _, parameter := range parameters {
+		names = append(names, argumentName(arguments[parameter]))
+	}
+	return names
+}
+
+func bindingNames(bindings Bindings) map[string]string {
+	if bindings == nil {
+		return nil
+	}
+	names := make(map[string]string, len(bindings))
+	for variable, value := range bindings {
+		names[variable] = argumentName(value)
+	}
+	return names
+}
+
+func resolveBindings(names map[string]string, state *State) Bindings {
+	if names == nil {
+		return nil
+	}
+	bindings := make(Bindings, len(names))
+	for variable, name := range names {
+		bindings[variable] = resolveArgument(name, state)
+	}
+	return bindings
+}
+
+// resolveArgument returns the actor with the name, or the name itself when no actor has it
+func resolveArgument(name string, state *State) any {
+	if a, ok := state.Actors[name]; ok {
+		return a
+	}
+	return name
+}
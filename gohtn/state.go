@@ -2,40 +2,166 @@ package gohtn
 
 import (
 	"fmt"
+	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/logging"
 	"strings"
+	"sync"
 )
 
 type Value[T any] func(state *State) T
 
-// Property is a named function that accepts the state and returns a generic typed value.
+// Property is a named function that accepts the state and returns a generic typed value.  A Property set by an Effect
+// is a fact, holding a constant value recorded by snapshots.
 type Property[T any] struct {
-	Name  string
-	Value Value[T]
+	Name   string
+	Value  Value[T]
+	fact   bool
+	origin *Property[T]
 }
 
-// State is represented as an array of Sensors and a map of named Properties.
+// State is represented as an array of Sensors and a map of named Properties.  A synchronized State may be shared by
+// tasks running in parallel, in which case it must be changed through Update.
 type State struct {
 	Sensors    map[string]any
 	Properties map[string]any
+	Actors     actor.Actors
+	Bindings   Bindings
+	Logger     logging.Logger
+	Metrics    Metrics
+	mutex      *sync.RWMutex
+}
+
+// Bind returns a view of the State with the given Bindings.  The view shares the Sensors and Properties of the State,
+// so effects applied through it change the State itself.
+func (s *State) Bind(bindings Bindings) *State {
+	return &State{
+		Sensors:    s.Sensors,
+		Properties: s.Properties,
+		Actors:     s.Actors,
+		Bindings:   bindings,
+		Logger:     s.Logger,
+		Metrics:    s.Metrics,
+		mutex:      s.mutex,
+	}
+}
+
+// WithLogger returns a view of the State that logs through the Logger
+func (s *State) WithLogger(logger logging.Logger) *State {
+	view := s.Bind(s.Bindings)
+	view.Logger = logger
+	return view
+}
+
+// Log returns the Logger of the State, which is silent when none is set
+func (s *State) Log() logging.Logger {
+	return logging.OrNop(s.Logger)
+}
+
+// Synchronized returns a view of the State that is safe to share between goroutines
+func (s *State) Synchronized() *State {
+	if s.mutex != nil {
+		return s
+	}
+	synchronized := s.Bind(s.Bindings)
+	synchronized.mutex = &sync.RWMutex{}
+	return synchronized
+}
+
+// Update runs the function with exclusive access to the State.  The function is handed a view of the State to read
+// and change, since lookups through the synchronized State would wait on the lock Update holds.
+func (s *State) Update(update func(state *State) error) error {
+	if s.mutex == nil {
+		return update(s)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	locked := s.Bind(s.Bindings)
+	locked.mutex = nil
+	return update(locked)
+}
+
+func (s *State) rlock() func() {
+	if s.mutex == nil {
+		return func() {}
+	}
+	s.mutex.RLock()
+	return s.mutex.RUnlock
+}
+
+// BoundActor returns the actor bound to the variable
+func (s *State) BoundActor(variable string) (actor.Actor, error) {
+	value, ok := s.Bindings[variable]
+	if !ok {
+		return nil, fmt.Errorf("variable %s is not bound", variable)
+	}
+	a, ok := value.(actor.Actor)
+	if !ok {
+		return nil, fmt.Errorf("variable %s is bound to %T, not an actor", variable, value)
+	}
+	return a, nil
 }
 
 func (s *State) Property(name string) (any, error) {
+	unlock := s.rlock()
 	property, ok := s.Properties[name]
+	unlock()
 	if !ok {
 		return 0, fmt.Errorf("no Property with name %s", name)
 	}
 	return property, nil
 }
 
+// Number resolves a numeric Property to its float64 value
+func (s *State) Number(name string) (float64, error) {
+	property, err := s.Property(name)
+	if err != nil {
+		return 0, err
+	}
+	switch p := property.(type) {
+	case *Property[float64]:
+		return p.Value(s), nil
+	case *Property[int64]:
+		return float64(p.Value(s)), nil
+	case *Property[int]:
+		return float64(p.Value(s)), nil
+	}
+	return 0, fmt.Errorf("property %s of type %T is not numeric", name, property)
+}
+
 func (s *State) Sensor(name string) (any, error) {
+	unlock := s.rlock()
 	sensor, ok := s.Sensors[name]
+	unlock()
 	if !ok {
 		return nil, fmt.Errorf("no sensor with name %s", name)
 	}
 	return sensor, nil
 }
 
+// Clone returns a copy of the State whose Properties can be replaced without changing the original.  The Sensors
+// themselves are shared, so the copy still observes the live world.
+func (s *State) Clone() *State {
+	defer s.rlock()()
+	sensors := make(map[string]any, len(s.Sensors))
+	for name, sensor := range s.Sensors {
+		sensors[name] = sensor
+	}
+	properties := make(map[string]any, len(s.Properties))
+	for name, property := range s.Properties {
+		properties[name] = property
+	}
+	return &State{
+		Sensors:    sensors,
+		Properties: properties,
+		Actors:     s.Actors,
+		Bindings:   s.Bindings,
+		Logger:     s.Logger,
+		Metrics:    s.Metrics,
+	}
+}
+
 func (s *State) String() string {
+	defer s.rlock()()
 	sensors := make([]string, 0)
 	for sensor := range s.Sensors {
 		sensors = append(sensors, fmt.Sprintf("{%s}", sensor))
@@ -0,0 +1,26 @@
+package gohtn
+
+// TaskStatus is the lifecycle state of a Task.  A Task starts Pending, is Running while a long-lived Action spans
+// several executions, and finishes as Succeeded, Failed or Cancelled.
+type TaskStatus string
+
+const (
+	Pending   TaskStatus = "pending"
+	Running   TaskStatus = "running"
+	Succeeded TaskStatus = "succeeded"
+	Failed    TaskStatus = "failed"
+	Cancelled TaskStatus = "cancelled"
+)
+
+// IsDone reports whether the status is final
+func (s TaskStatus) IsDone() bool {
+	return s == Succeeded || s == Failed || s == Cancelled
+}
+
+// orPending maps the zero value to Pending
+func (s TaskStatus) orPending() TaskStatus {
+	if len(s) == 0 {
+		return Pending
+	}
+	return s
+}
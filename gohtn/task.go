@@ -1,14 +1,23 @@
 package gohtn
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/logging"
+	"math/rand"
 	"strings"
 )
 
+// Task is a node of the task network.  Execute advances the Task and returns its status, which is also available
+// through Status.  A Task is complete once it has Succeeded.  The context given to Execute is handed down to the
+// actions of the Task, and a Task interrupted by its context is Cancelled.
 type Task interface {
-	Execute(state *State) (*State, error)
+	Execute(ctx context.Context, state *State) (TaskStatus, error)
+	Status() TaskStatus
 	IsComplete() bool
+	Cancel()
+	Reset()
 	Name() string
 	String() string
 }
@@ -17,48 +26,159 @@ type Tasks map[string]Task
 type TaskResolver func() (Task, error)
 type TaskResolvers map[string]TaskResolver
 
-// Action is an action applied by a Task.
-type Action func(state *State) error
+// isTemplate reports whether a task declares parameters but has not been grounded with arguments
+func isTemplate(parameters []string, arguments Bindings) bool {
+	return len(parameters) > 0 && arguments == nil
+}
+
+// Action is an action applied by a Task.  A long-running action returns Running until it has finished, and is called
+// again on every execution of the Task until it returns Succeeded or Failed.  An action changes the State through
+// State.Update only, since it may run on a branch of a ParallelTask sharing the State with the other branches.
+type Action func(state *State) (TaskStatus, error)
+
+// ContextAction is an Action that is handed the context of the execution.  The context is cancelled when the engine
+// shuts down or the plan running the action is abandoned, and carries the deadline of a Timeout decorator, so a slow
+// action should return once it is done.
+type ContextAction func(ctx context.Context, state *State) (TaskStatus, error)
+
+// WithContext adapts an Action to a ContextAction.  The Action itself can not be interrupted, so it is only skipped
+// when the context is already done.
+func WithContext(action Action) ContextAction {
+	return func(ctx context.Context, state *State) (TaskStatus, error) {
+		if ctx.Err() != nil {
+			return Cancelled, ctx.Err()
+		}
+		return action(state)
+	}
+}
 
 // PrimitiveTask implements the HTN primitive Task.   It contains a set of preconditions that must be met
-// before it will execute.  Once the preconditions are met, the Action is applied, then the completion flag is set.
+// before it will execute.  Once the preconditions are met, the Action is applied and the task takes on the status the
+// Action returns.  The Compensation undoes the Action when an Executor rolls back a failed plan.
 type PrimitiveTask struct {
-	Preconditions []Condition `json:"preconditions"`
-	Complete      bool        `json:"complete"`
-	Action        Action      `json:"action"`
-	TaskName      string      `json:"name"`
+	Preconditions  []Condition   `json:"preconditions"`
+	TaskStatus     TaskStatus    `json:"status"`
+	Action         ContextAction `json:"action"`
+	Compensation   ContextAction `json:"compensation"`
+	TaskName       string        `json:"name"`
+	Effects        []*Effect     `json:"effects"`
+	ApplyEffects   bool          `json:"applyEffects"`
+	Cost           Cost          `json:"cost"`
+	ResetPolicy    *ResetPolicy  `json:"reset"`
+	TaskParameters []string      `json:"parameters"`
+	Arguments      Bindings      `json:"arguments"`
+	instances      instances
 }
 
-func (t *PrimitiveTask) Execute(state *State) (*State, error) {
-	preconditions := make([]string, 0)
-	for _, condition := range t.Preconditions {
-		preconditions = append(preconditions, condition.String())
+func (t *PrimitiveTask) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	if isTemplate(t.TaskParameters, t.Arguments) {
+		return Failed, fmt.Errorf("task %s must be grounded with its parameters before it is executed", t.Name())
 	}
-	log.Printf("executing Task {%s}, preconditions {%s}", t.Name(), strings.Join(preconditions, ","))
-	// Determine if the Task preconditions have been met
-	var ready = true
-	for _, condition := range t.Preconditions {
-		log.Printf("evaluating condition {%s}", condition.String())
-		if !condition.IsMet(state) {
-			ready = false
-			break
+	state = state.Bind(t.Arguments)
+	logger := state.Log().With(logging.Task(t.Name()))
+	logger.Debug("executing task", logging.F("status", t.Status()))
+	if t.Status() != Running {
+		// Determine if the Task preconditions have been met
+		for _, condition := range t.Preconditions {
+			logger.Debug("evaluating condition", logging.F("condition", condition.String()))
+			if !isMet(condition, state) {
+				emit(ctx, Event{Type: TaskSkipped, Task: t.Name(), Status: t.Status(), Reason: condition.String()})
+				return t.Status(), nil
+			}
 		}
+		logger.Debug("preconditions met, applying task action")
+		emit(ctx, Event{Type: TaskStarted, Task: t.Name(), Status: Running})
+	}
+	status, err := t.apply(ctx, state)
+	if event, ok := taskEvent(t, status, err); ok {
+		emit(ctx, event)
 	}
-	if ready {
-		log.Printf("Task {%s} preconditions met, applying Task action", t.Name())
-		// Apply the Task action and update the state
-		err := t.Action(state)
+	return status, err
+}
+
+// apply runs the Task action and applies the Effects once it succeeds
+func (t *PrimitiveTask) apply(ctx context.Context, state *State) (TaskStatus, error) {
+	// Apply the Task action and update the state
+	status := Succeeded
+	if t.Action != nil {
+		var err error
+		status, err = t.Action(ctx, state)
+		// an action interrupted by its context was cancelled rather than failed
+		if ctx.Err() != nil && (err != nil || status == Cancelled) {
+			t.TaskStatus = Cancelled
+			return t.TaskStatus, ctx.Err()
+		}
+		if err != nil {
+			t.TaskStatus = Failed
+			return t.TaskStatus, err
+		}
+	}
+	if status == Succeeded && t.ApplyEffects {
+		err := applyEffects(t.Effects, state)
 		if err != nil {
-			return nil, err
+			t.TaskStatus = Failed
+			return t.TaskStatus, err
 		}
-		// Set the Task to 'complete' so it doesn't execute again
-		t.Complete = true
 	}
-	return state, nil
+	// A succeeded Task is complete, so it doesn't execute again
+	t.TaskStatus = status
+	return t.TaskStatus, nil
+}
+
+func (t *PrimitiveTask) Status() TaskStatus {
+	return t.TaskStatus.orPending()
 }
 
 func (t *PrimitiveTask) IsComplete() bool {
-	return t.Complete
+	return t.Status() == Succeeded
+}
+
+func (t *PrimitiveTask) Cancel() {
+	if t.Status() == Running {
+		t.TaskStatus = Cancelled
+	}
+}
+
+func (t *PrimitiveTask) Reset() {
+	t.TaskStatus = Pending
+}
+
+func (t *PrimitiveTask) Policy() *ResetPolicy {
+	return t.ResetPolicy
+}
+
+func (t *PrimitiveTask) Parameters() []string {
+	return t.TaskParameters
+}
+
+// Ground returns the instance of the task bound to the arguments
+func (t *PrimitiveTask) Ground(arguments []any) (Task, error) {
+	bindings, err := bind(t.Name(), t.TaskParameters, arguments)
+	if err != nil {
+		return nil, err
+	}
+	name := groundName(t.Name(), arguments)
+	return t.instances.get(name, arguments, func() Task {
+		return &PrimitiveTask{
+			Preconditions: t.Preconditions,
+			Action:        t.Action,
+			Compensation:  t.Compensation,
+			TaskName:      name,
+			Effects:       t.Effects,
+			ApplyEffects:  t.ApplyEffects,
+			Cost:          t.Cost,
+			ResetPolicy:   t.ResetPolicy.Clone(),
+			Arguments:     bindings,
+		}
+	}), nil
+}
+
+func (t *PrimitiveTask) Instances() []Task {
+	return t.instances.all()
+}
+
+func (t *PrimitiveTask) Evict(actors actor.Actors) {
+	t.instances.evict(actors)
 }
 
 func (t *PrimitiveTask) Name() string {
@@ -70,35 +190,109 @@ func (t *PrimitiveTask) String() string {
 	for _, condition := range t.Preconditions {
 		preconditions = append(preconditions, condition.String())
 	}
-	return fmt.Sprintf("[%s] preconditions: [%s], complete: %t", t.Name(), strings.Join(preconditions, ","), t.Complete)
+	effects := make([]string, 0)
+	for _, effect := range t.Effects {
+		effects = append(effects, effect.String())
+	}
+	return fmt.Sprintf("[%s] preconditions: [%s], effects: [%s], cost: %s, status: %s", t.Name(), strings.Join(preconditions, ","), strings.Join(effects, ","), t.Cost.String(), t.Status())
 }
 
-// GoalTask implements the HTN goal Task, composed of preconditions that are other TaskResolvers.  The goal Task is considered
-// complete when all condition TaskResolvers are themselves complete.
+// GoalTask implements the HTN goal Task, a desired state of the world expressed as preconditions.  The planner
+// achieves it by searching for a sequence of candidate tasks, up to MaxSteps long, whose effects meet them all.
 type GoalTask struct {
-	Preconditions []*TaskCondition `json:"preconditions"`
-	Complete      bool             `json:"complete"`
-	TaskName      string           `json:"name"`
-}
-
-func (g *GoalTask) Execute(state *State) (*State, error) {
-	log.Println("executing goal Task")
-	if !g.Complete {
-		log.Println("goal Task is not complete checking preconditions")
-		for _, condition := range g.Preconditions {
-			if !condition.IsMet(state) {
-				log.Println("goal precondition not met, exiting")
-				return state, nil
+	Preconditions []Condition `json:"preconditions"`
+	Tasks         []Task      `json:"tasks"`
+	MaxSteps      int         `json:"maxSteps"`
+	TaskName      string      `json:"name"`
+	met           bool
+}
+
+func (g *GoalTask) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	status := g.Evaluate(state)
+	state.Log().Debug("executing goal task", logging.Task(g.Name()), logging.F("status", status))
+	return status, nil
+}
+
+// Evaluate checks the preconditions against the live State and returns the resulting status
+func (g *GoalTask) Evaluate(state *State) TaskStatus {
+	g.met = g.Unmet(nil, state) == nil
+	return g.Status()
+}
+
+// Unmet returns the first precondition that is not met in the State, or nil when the goal is met.  Tasks in the plan
+// count as complete, so a simulated State can be checked along with the plan that produced it.
+func (g *GoalTask) Unmet(plan *Plan, state *State) Condition {
+	for _, condition := range g.Preconditions {
+		if taskCondition, ok := condition.(*TaskCondition); ok {
+			if isMet(taskCondition, state) || (plan != nil && plan.contains(taskCondition.Task)) {
+				continue
+			}
+			return condition
+		}
+		if !isMet(condition, state) {
+			return condition
+		}
+	}
+	return nil
+}
+
+// Candidates returns the tasks the planner may use to achieve the goal
+func (g *GoalTask) Candidates() []Task {
+	candidates := make([]Task, 0, len(g.Preconditions)+len(g.Tasks))
+	for _, condition := range g.Preconditions {
+		if taskCondition, ok := condition.(*TaskCondition); ok {
+			candidates = append(candidates, taskCondition.Task)
+		}
+	}
+	return append(candidates, g.Tasks...)
+}
+
+func (g *GoalTask) maxSteps() int {
+	if g.MaxSteps > 0 {
+		return g.MaxSteps
+	}
+	return len(g.Candidates())
+}
+
+func (g *GoalTask) Status() TaskStatus {
+	status := Succeeded
+	for _, condition := range g.Preconditions {
+		taskCondition, ok := condition.(*TaskCondition)
+		if !ok {
+			if !g.met && status == Succeeded {
+				status = Pending
+			}
+			continue
+		}
+		switch taskCondition.Task.Status() {
+		case Failed:
+			return Failed
+		case Cancelled:
+			return Cancelled
+		case Running:
+			status = Running
+		case Pending:
+			if status == Succeeded {
+				status = Pending
 			}
 		}
-		log.Println("goal conditions met, goal Task is complete.")
-		g.Complete = true
 	}
-	return state, nil
+	return status
 }
 
 func (g *GoalTask) IsComplete() bool {
-	return g.Complete
+	return g.Status() == Succeeded
+}
+
+func (g *GoalTask) Cancel() {
+	for _, task := range g.Candidates() {
+		task.Cancel()
+	}
+}
+
+// Reset clears the last evaluation, since the rest of the goal status is derived from its condition tasks
+func (g *GoalTask) Reset() {
+	g.met = false
 }
 
 func (g *GoalTask) Name() string {
@@ -110,103 +304,204 @@ func (g *GoalTask) String() string {
 	for _, condition := range g.Preconditions {
 		preconditions = append(preconditions, fmt.Sprintf("{%s}", condition.String()))
 	}
-	return fmt.Sprintf("goal: preconditions: [%s], complete: %t", strings.Join(preconditions, ","), g.Complete)
+	tasks := make([]string, 0)
+	for _, task := range g.Tasks {
+		tasks = append(tasks, fmt.Sprintf("{%s}", task.Name()))
+	}
+	return fmt.Sprintf("goal: preconditions: [%s], tasks: [%s], status: %s", strings.Join(preconditions, ","), strings.Join(tasks, ","), g.Status())
 }
 
-type Method struct {
-	Conditions    []Condition
-	TaskResolvers TaskResolvers
-	Name          string
+// CompoundTask implements the HTN compound task, which consists of a ranked list of methods and a name.
+// The task selects a method at execution time by checking the conditions on each.  Since the method list
+// is in priority order, the first match is selected when more than one apply, unless Selection ranks them otherwise.
+// The task takes on the status of the method a plan committed it to.
+type CompoundTask struct {
+	Methods        []*Method    `json:"methods"`
+	Selection      Selection    `json:"selection"`
+	Random         *rand.Rand   `json:"-"`
+	AvoidRepeat    bool         `json:"avoidRepeat"`
+	TaskName       string       `json:"name"`
+	TaskStatus     TaskStatus   `json:"status"`
+	ResetPolicy    *ResetPolicy `json:"reset"`
+	TaskParameters []string     `json:"parameters"`
+	Arguments      Bindings     `json:"arguments"`
+	selected       *Method
+	bindings       Bindings
+	instances      instances
+	scores         []*MethodScore
+	last           *Method
 }
 
-func (m *Method) Applies(state *State) bool {
-	log.Printf("checking if method {%s} applies", m.Name)
-	for _, condition := range m.Conditions {
-		if !condition.IsMet(state) {
-			log.Printf("method {%s} condition {%s} not met, exiting", m.Name, condition.String())
-			return false
-		}
+func (c *CompoundTask) Execute(ctx context.Context, state *State) (TaskStatus, error) {
+	logger := state.Log().With(logging.Task(c.Name()))
+	logger.Debug("executing compound task", logging.F("status", c.Status()))
+	if isTemplate(c.TaskParameters, c.Arguments) {
+		return Failed, fmt.Errorf("task %s must be grounded with its parameters before it is executed", c.Name())
 	}
-	return true
-}
-
-func (m *Method) Execute(state *State) (int64, error) {
-	log.Printf("executing method {%s}", m.Name)
-	var executed = int64(0)
-	tasks := make([]Task, 0)
-	for _, taskResolver := range m.TaskResolvers {
-		task, err := taskResolver()
+	// the method committed by a plan, or still running, is kept until it is done
+	if c.selected == nil || c.Status().IsDone() {
+		bound := state.Bind(c.Arguments)
+		methods, err := c.Rank(bound)
 		if err != nil {
-			return 0, err
+			return Failed, err
 		}
-		tasks = append([]Task{task}, tasks...)
-	}
-	for _, task := range tasks {
-		if !task.IsComplete() {
-			log.Printf("method {%s} task {%s} not complete, executing it", m.Name, task.String())
-			_, err := task.Execute(state)
-			if err != nil {
-				return -1, err
+		var selected *Method
+		var bindings []Bindings
+		for _, method := range methods {
+			bindings = method.Bindings(bound)
+			if len(bindings) > 0 {
+				selected = method
+				break
 			}
-			executed++
 		}
+		if selected == nil {
+			logger.Debug("no applicable methods found")
+			return c.Status(), &DecompositionError{Task: c.Name(), Err: ErrNoApplicableMethod}
+		}
+		// The methods are ranked in selection order, so the first one is the selected choice, with its first binding
+		c.selected = selected
+		c.bindings = bindings[0]
+		c.chose(selected)
+		emit(ctx, Event{Type: MethodSelected, Task: c.Name(), Method: selected.Name})
+	}
+	status, err := c.selected.Execute(ctx, state.Bind(c.bindings))
+	c.TaskStatus = status
+	if event, ok := taskEvent(c, status, err); ok {
+		emit(ctx, event)
+	}
+	if err != nil {
+		return c.TaskStatus, err
 	}
-	return executed, nil
+	logger.Debug("compound task method executed", logging.Method(c.selected.Name), logging.F("status", status))
+	return c.TaskStatus, nil
+}
+
+// Status is the status of the selected method, derived from its subtasks, or Pending before a method is selected
+func (c *CompoundTask) Status() TaskStatus {
+	return c.status(nil)
 }
 
-func (m *Method) String() string {
-	conditions := make([]string, 0)
-	for _, condition := range m.Conditions {
-		conditions = append(conditions, fmt.Sprintf("{%s}", condition.String()))
+// status derives the status from the selected method.  Tasks being evaluated are skipped, since a method may list
+// its own compound task as a subtask.
+func (c *CompoundTask) status(evaluating map[*CompoundTask]bool) TaskStatus {
+	if c.selected == nil || c.TaskStatus == Cancelled || evaluating[c] {
+		return c.TaskStatus.orPending()
 	}
-	tasks := make([]string, 0)
-	for taskName := range m.TaskResolvers {
-		tasks = append(tasks, fmt.Sprintf("{%s}", taskName))
+	if evaluating == nil {
+		evaluating = make(map[*CompoundTask]bool)
 	}
-	return fmt.Sprintf("Method %s:\n  conditions: \n   %s\n  tasks: \n   %s", m.Name, strings.Join(conditions, ",\n   "), strings.Join(tasks, ",\n   "))
+	evaluating[c] = true
+	defer delete(evaluating, c)
+	return c.selected.status(c.bindings, evaluating)
 }
 
-// CompoundTask implements the HTN compound task, which consists of a ranked list of methods and a name.
-// The task selects a method at execution time by checking the conditions on each.  Since the method list
-// is in priority order, the first match is selected when more than one apply.
-type CompoundTask struct {
-	Methods  []*Method `json:"methods"`
-	TaskName string    `json:"name"`
-	Complete bool      `json:"complete"`
+func (c *CompoundTask) Name() string {
+	return c.TaskName
 }
 
-func (c *CompoundTask) Execute(state *State) (*State, error) {
-	log.Printf("executing compound task {%s}", c.Name())
-	applicableMethods := make([]*Method, 0)
-	for _, method := range c.Methods {
-		if method.Applies(state) {
-			applicableMethods = append(applicableMethods, method)
+func (c *CompoundTask) IsComplete() bool {
+	return c.Status() == Succeeded
+}
+
+func (c *CompoundTask) Cancel() {
+	if c.Status() != Running {
+		return
+	}
+	if c.selected != nil {
+		c.selected.Cancel()
+	}
+	c.TaskStatus = Cancelled
+}
+
+func (c *CompoundTask) Reset() {
+	c.TaskStatus = Pending
+	c.selected = nil
+	c.bindings = nil
+}
+
+func (c *CompoundTask) Policy() *ResetPolicy {
+	return c.ResetPolicy
+}
+
+func (c *CompoundTask) Parameters() []string {
+	return c.TaskParameters
+}
+
+// Rank returns the methods in the order they are tried against the State
+func (c *CompoundTask) Rank(state *State) ([]*Method, error) {
+	if c.Selection == SelectWeighted {
+		methods, err := weightedMethods(c.Methods, c.Random)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", c.Name(), err)
 		}
+		return c.avoidRepeat(methods), nil
 	}
-	if len(applicableMethods) == 0 {
-		log.Println("no applicable methods found")
-		c.Complete = true
-		return state, nil
+	methods, scores := rankMethods(c.Methods, c.Selection, state, state.Log().With(logging.Task(c.Name())))
+	if scores != nil {
+		state.Log().Debug("ranked methods by score", logging.Task(c.Name()), logging.F("scores", scores))
+		c.scores = scores
 	}
-	// The methods are stored in priority order, so the first one is the selected choice
-	selectedMethod := applicableMethods[0]
-	executedTasks, err := selectedMethod.Execute(state)
-	if err != nil {
-		return nil, err
+	return c.avoidRepeat(methods), nil
+}
+
+// avoidRepeat moves the method chosen last to the end of the ranking when AvoidRepeat is set
+func (c *CompoundTask) avoidRepeat(methods []*Method) []*Method {
+	if !c.AvoidRepeat || c.last == nil || len(methods) < 2 {
+		return methods
 	}
-	if executedTasks == 0 {
-		log.Printf("method {%s} execute zero tasks", c.Name())
+	ranked := make([]*Method, 0, len(methods))
+	for _, method := range methods {
+		if method != c.last {
+			ranked = append(ranked, method)
+		}
 	}
+	return append(ranked, c.last)
+}
 
-	return state, nil
+// chose records the method the task was decomposed through or executed with
+func (c *CompoundTask) chose(method *Method) {
+	c.last = method
 }
 
-func (c *CompoundTask) Name() string {
-	return c.TaskName
+// commit selects the method a plan decomposed the task through, so the task takes its status from that method
+func (c *CompoundTask) commit(method *Method, bindings Bindings) {
+	c.selected = method
+	c.bindings = bindings
+	c.TaskStatus = Pending
+	c.chose(method)
 }
 
-func (c *CompoundTask) IsComplete() bool {
-	return c.Complete
+// Scores returns the method scores of the last ranking by utility
+func (c *CompoundTask) Scores() []*MethodScore {
+	return c.scores
+}
+
+// Ground returns the instance of the task bound to the arguments
+func (c *CompoundTask) Ground(arguments []any) (Task, error) {
+	bindings, err := bind(c.Name(), c.TaskParameters, arguments)
+	if err != nil {
+		return nil, err
+	}
+	name := groundName(c.Name(), arguments)
+	return c.instances.get(name, arguments, func() Task {
+		return &CompoundTask{
+			Methods:     c.Methods,
+			Selection:   c.Selection,
+			Random:      c.Random,
+			AvoidRepeat: c.AvoidRepeat,
+			TaskName:    name,
+			ResetPolicy: c.ResetPolicy.Clone(),
+			Arguments:   bindings,
+		}
+	}), nil
+}
+
+func (c *CompoundTask) Instances() []Task {
+	return c.instances.all()
+}
+
+func (c *CompoundTask) Evict(actors actor.Actors) {
+	c.instances.evict(actors)
 }
 
 func (c *CompoundTask) String() string {
@@ -214,5 +509,9 @@ func (c *CompoundTask) String() string {
 	for _, method := range c.Methods {
 		methods = append(methods, fmt.Sprintf("{%s}", method.String()))
 	}
-	return fmt.Sprintf("CompoundTask %s: methods: \n %s\n", c.Name(), strings.Join(methods, ",\n "))
+	selection := c.Selection
+	if len(selection) == 0 {
+		selection = SelectPriority
+	}
+	return fmt.Sprintf("CompoundTask %s: status: %s, selection: %s, methods: \n %s\n", c.Name(), c.Status(), selection, strings.Join(methods, ",\n "))
 }
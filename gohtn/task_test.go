@@ -0,0 +1,153 @@
+package gohtn
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// primitive returns a task whose action finishes with the status
+func primitive(name string, status TaskStatus) *PrimitiveTask {
+	return &PrimitiveTask{
+		TaskName: name,
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			return status, nil
+		},
+	}
+}
+
+func resolver(task Task) TaskResolver {
+	return func() (Task, error) {
+		return task, nil
+	}
+}
+
+// method returns a totally ordered method decomposing into the tasks
+func method(name string, tasks ...Task) *Method {
+	m := &Method{Name: name, TaskResolvers: make(TaskResolvers)}
+	for _, task := range tasks {
+		m.Tasks = append(m.Tasks, task.Name())
+		m.TaskResolvers[task.Name()] = resolver(task)
+	}
+	return m
+}
+
+// graph returns a task graph whose network is the roots in order
+func graph(roots ...Task) *TaskGraph {
+	root := &TaskNode{TaskResolver: resolver(roots[0])}
+	for _, task := range roots[1:] {
+		root.Children = append(root.Children, &TaskNode{TaskResolver: resolver(task)})
+	}
+	return &TaskGraph{Root: root}
+}
+
+func newState() *State {
+	return &State{Properties: make(map[string]any), Sensors: make(map[string]any)}
+}
+
+func TestCompoundTaskTakesTheStatusOfItsPlannedMethod(t *testing.T) {
+	tests := []struct {
+		last     TaskStatus
+		expected TaskStatus
+	}{
+		{last: Succeeded, expected: Succeeded},
+		{last: Running, expected: Running},
+		{last: Failed, expected: Failed},
+	}
+	for _, test := range tests {
+		t.Run(string(test.last), func(t *testing.T) {
+			first := primitive("First", Succeeded)
+			last := primitive("Last", test.last)
+			compound := &CompoundTask{TaskName: "Compound", Methods: []*Method{method("Both", first, last)}}
+			planner := &Planner{Tasks: graph(compound)}
+			state := newState()
+			plan, err := planner.Plan(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if compound.Status() != Pending {
+				t.Fatalf("expected the planned task to be pending, got %s", compound.Status())
+			}
+			executor := &Executor{}
+			_, err = executor.Execute(context.Background(), plan, state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.Status() != Succeeded {
+				t.Fatalf("expected the first subtask to succeed, got %s", first.Status())
+			}
+			if compound.Status() != test.expected {
+				t.Fatalf("expected the compound task to be %s, got %s", test.expected, compound.Status())
+			}
+			if compound.IsComplete() != (test.expected == Succeeded) {
+				t.Fatalf("expected the compound task to be complete only once it succeeded")
+			}
+		})
+	}
+}
+
+func TestCompoundTaskIsRunningWhileItsMethodIsInProgress(t *testing.T) {
+	first := primitive("First", Succeeded)
+	last := primitive("Last", Succeeded)
+	compound := &CompoundTask{TaskName: "Compound", Methods: []*Method{method("Both", first, last)}}
+	plan, err := (&Planner{Tasks: graph(compound)}).Plan(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = plan.Tasks[0].Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compound.Status() != Running {
+		t.Fatalf("expected the compound task to be running, got %s", compound.Status())
+	}
+}
+
+func TestCompoundTaskListingItselfHasAStatus(t *testing.T) {
+	first := primitive("First", Succeeded)
+	compound := &CompoundTask{TaskName: "Loop"}
+	compound.Methods = []*Method{method("Again", first, compound)}
+	compound.commit(compound.Methods[0], nil)
+	if compound.Status() != Pending {
+		t.Fatalf("expected the recursive task to be pending, got %s", compound.Status())
+	}
+}
+
+func TestWithContextSkipsTheActionOnceTheContextIsDone(t *testing.T) {
+	runs := 0
+	action := WithContext(func(state *State) (TaskStatus, error) {
+		runs++
+		return Succeeded, nil
+	})
+	status, err := action(context.Background(), newState())
+	if err != nil || status != Succeeded || runs != 1 {
+		t.Fatalf("expected the action to run, got %s after %d runs and %v", status, runs, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, err = action(ctx, newState())
+	if !errors.Is(err, context.Canceled) || status != Cancelled || runs != 1 {
+		t.Fatalf("expected the action to be skipped, got %s after %d runs and %v", status, runs, err)
+	}
+}
+
+func TestAnActionInterruptedByItsContextIsCancelled(t *testing.T) {
+	started := make(chan struct{})
+	task := &PrimitiveTask{
+		TaskName: "Haggle",
+		Action: func(ctx context.Context, state *State) (TaskStatus, error) {
+			close(started)
+			<-ctx.Done()
+			return Failed, ctx.Err()
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	status, err := task.Execute(ctx, newState())
+	if !errors.Is(err, context.Canceled) || status != Cancelled || task.Status() != Cancelled {
+		t.Fatalf("expected the interrupted action to be cancelled rather than failed, got %s and %v", status, err)
+	}
+}
@@ -0,0 +1,259 @@
+package gohtn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/logging"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+type CurveType string
+
+const (
+	Linear   CurveType = "linear"
+	Logistic CurveType = "logistic"
+	Step     CurveType = "step"
+)
+
+// Curve is a response curve mapping a property value to a score.  A Linear curve returns Slope * x + Intercept, where
+// a Slope of zero is treated as one.  A Logistic curve rises from 0 to 1 around Midpoint, with Steepness controlling
+// how sharply, treated as one when zero.  A Step curve returns Low below Threshold and High from Threshold up.
+type Curve struct {
+	Type      CurveType `json:"type"`
+	Slope     float64   `json:"slope,omitempty"`
+	Intercept float64   `json:"intercept,omitempty"`
+	Midpoint  float64   `json:"midpoint,omitempty"`
+	Steepness float64   `json:"steepness,omitempty"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Low       float64   `json:"low,omitempty"`
+	High      float64   `json:"high,omitempty"`
+}
+
+func (c *Curve) Validate() error {
+	switch c.Type {
+	case Linear, Logistic, Step:
+		return nil
+	}
+	return fmt.Errorf("unknown response curve %s", c.Type)
+}
+
+func (c *Curve) Apply(x float64) float64 {
+	switch c.Type {
+	case Linear:
+		slope := c.Slope
+		if slope == 0 {
+			slope = 1
+		}
+		return slope*x + c.Intercept
+	case Logistic:
+		steepness := c.Steepness
+		if steepness == 0 {
+			steepness = 1
+		}
+		return 1 / (1 + math.Exp(-steepness*(x-c.Midpoint)))
+	case Step:
+		if x >= c.Threshold {
+			return c.High
+		}
+		return c.Low
+	}
+	return 0
+}
+
+func (c *Curve) String() string {
+	switch c.Type {
+	case Linear:
+		return fmt.Sprintf("linear(%v, %v)", c.Slope, c.Intercept)
+	case Logistic:
+		return fmt.Sprintf("logistic(%v, %v)", c.Midpoint, c.Steepness)
+	case Step:
+		return fmt.Sprintf("step(%v, %v, %v)", c.Threshold, c.Low, c.High)
+	}
+	return string(c.Type)
+}
+
+// Consideration scores a numeric Property through a response Curve
+type Consideration struct {
+	Property string `json:"property"`
+	Curve    Curve  `json:"curve"`
+}
+
+func (c *Consideration) Evaluate(state *State) (float64, error) {
+	value, err := state.Number(c.Property)
+	if err != nil {
+		return 0, err
+	}
+	return c.Curve.Apply(value), nil
+}
+
+func (c *Consideration) String() string {
+	return fmt.Sprintf("%s(%s)", c.Curve.String(), c.Property)
+}
+
+// Scorer is a scoring function over the State
+type Scorer func(state *State) (float64, error)
+
+// Utility is the score of a Method when its compound task selects by utility.  A Scorer function takes precedence,
+// looked up by ScorerName when the Utility is loaded from a spec.  Otherwise the score is the product of the
+// Considerations, or the static Value when there are none.  Specs may declare a static score as a bare number.
+type Utility struct {
+	Value          float64          `json:"value,omitempty"`
+	Considerations []*Consideration `json:"considerations,omitempty"`
+	ScorerName     string           `json:"scorer,omitempty"`
+	Scorer         Scorer           `json:"-"`
+}
+
+func (u *Utility) UnmarshalJSON(data []byte) error {
+	var value float64
+	if json.Unmarshal(data, &value) == nil {
+		*u = Utility{Value: value}
+		return nil
+	}
+	type utility Utility
+	spec := utility{}
+	err := json.Unmarshal(data, &spec)
+	if err != nil {
+		return err
+	}
+	*u = Utility(spec)
+	return nil
+}
+
+func (u *Utility) Validate() error {
+	for _, consideration := range u.Considerations {
+		err := consideration.Curve.Validate()
+		if err != nil {
+			return fmt.Errorf("consideration %s: %w", consideration.Property, err)
+		}
+	}
+	return nil
+}
+
+func (u *Utility) Evaluate(state *State) (float64, error) {
+	if u.Scorer != nil {
+		return u.Scorer(state)
+	}
+	if len(u.Considerations) == 0 {
+		return u.Value, nil
+	}
+	score := 1.0
+	for _, consideration := range u.Considerations {
+		value, err := consideration.Evaluate(state)
+		if err != nil {
+			return 0, err
+		}
+		score *= value
+	}
+	return score, nil
+}
+
+func (u *Utility) String() string {
+	if u.Scorer != nil || len(u.ScorerName) > 0 {
+		return fmt.Sprintf("scorer %s", u.ScorerName)
+	}
+	if len(u.Considerations) == 0 {
+		return fmt.Sprintf("%v", u.Value)
+	}
+	considerations := make([]string, 0, len(u.Considerations))
+	for _, consideration := range u.Considerations {
+		considerations = append(considerations, consideration.String())
+	}
+	return strings.Join(considerations, " * ")
+}
+
+type Selection string
+
+const (
+	// SelectPriority tries the methods of a compound task in list order
+	SelectPriority Selection = "priority"
+	// SelectUtility tries the methods of a compound task from the highest Utility score down
+	SelectUtility Selection = "utility"
+	// SelectWeighted tries the methods of a compound task in a random order drawn by their weights
+	SelectWeighted Selection = "weighted"
+)
+
+func (s Selection) Validate() error {
+	switch s {
+	case "", SelectPriority, SelectUtility, SelectWeighted:
+		return nil
+	}
+	return fmt.Errorf("unknown method selection %s", s)
+}
+
+// MethodScore is the Utility score of a Method the last time its compound task ranked its methods
+type MethodScore struct {
+	Method string
+	Score  float64
+}
+
+func (m *MethodScore) String() string {
+	return fmt.Sprintf("%s: %v", m.Method, m.Score)
+}
+
+// rankMethods returns the methods in the order they are tried under the selection, along with their scores when the
+// selection is by utility.  Methods with equal scores keep their priority order.  A method whose score can not be
+// evaluated is logged and dropped from the ranking, so it does not keep the other methods from being tried.
+func rankMethods(methods []*Method, selection Selection, state *State, logger logging.Logger) ([]*Method, []*MethodScore) {
+	if selection != SelectUtility {
+		return methods, nil
+	}
+	scores := make(map[*Method]float64, len(methods))
+	methodScores := make([]*MethodScore, 0, len(methods))
+	ranked := make([]*Method, 0, len(methods))
+	for _, method := range methods {
+		score, err := method.Score.Evaluate(state)
+		if err != nil {
+			logger.Warn("method can not be scored, dropping it", logging.F("method", method.Name), logging.Err(err))
+			continue
+		}
+		scores[method] = score
+		methodScores = append(methodScores, &MethodScore{Method: method.Name, Score: score})
+		ranked = append(ranked, method)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	return ranked, methodScores
+}
+
+// weightedMethods draws the methods without replacement, each with a probability proportional to its Weight among the
+// methods not drawn yet.  A method of Weight zero is never drawn, and drawing from methods that all weigh zero is an
+// error.
+func weightedMethods(methods []*Method, random *rand.Rand) ([]*Method, error) {
+	remaining := make([]*Method, 0, len(methods))
+	for _, method := range methods {
+		if method.Weight > 0 {
+			remaining = append(remaining, method)
+		}
+	}
+	if len(remaining) == 0 && len(methods) > 0 {
+		return nil, errors.New("every method weighs zero")
+	}
+	drawn := make([]*Method, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0.0
+		for _, method := range remaining {
+			total += method.Weight
+		}
+		var r float64
+		if random != nil {
+			r = random.Float64() * total
+		} else {
+			r = rand.Float64() * total
+		}
+		i := 0
+		for ; i < len(remaining)-1; i++ {
+			r -= remaining[i].Weight
+			if r < 0 {
+				break
+			}
+		}
+		drawn = append(drawn, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	return drawn, nil
+}
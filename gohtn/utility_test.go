@@ -0,0 +1,183 @@
+package gohtn
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// weightedTask returns a task drawing its methods by weight from a source seeded with the seed.  Every method is given
+// its weight explicitly, since a method without one weighs zero and is never drawn.
+func weightedTask(seed int64, weights ...float64) *CompoundTask {
+	task := &CompoundTask{TaskName: "Wander", Selection: SelectWeighted, Random: rand.New(rand.NewSource(seed))}
+	for i, weight := range weights {
+		m := method(string(rune('A' + i)))
+		m.Weight = weight
+		task.Methods = append(task.Methods, m)
+	}
+	return task
+}
+
+func draws(t *testing.T, task *CompoundTask, n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		methods, err := task.Rank(newState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(methods) != len(task.Methods) {
+			t.Fatalf("expected every method to be ranked, got %d of %d", len(methods), len(task.Methods))
+		}
+		names = append(names, methods[0].Name)
+	}
+	return names
+}
+
+func TestWeightedSelectionIsReproducibleFromTheSeed(t *testing.T) {
+	first := draws(t, weightedTask(7, 1, 2, 3), 20)
+	second := draws(t, weightedTask(7, 1, 2, 3), 20)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same draws from the same seed, got %v and %v", first, second)
+		}
+	}
+}
+
+func TestWeightedSelectionFollowsTheWeights(t *testing.T) {
+	counts := make(map[string]int)
+	for _, name := range draws(t, weightedTask(1, 1, 9), 1000) {
+		counts[name]++
+	}
+	if counts["B"] < 800 || counts["B"] > 980 {
+		t.Fatalf("expected the method of weight 9 to be drawn about 900 times in 1000, got %d", counts["B"])
+	}
+}
+
+func TestAvoidRepeatRanksTheLastMethodLast(t *testing.T) {
+	task := weightedTask(3, 1, 1, 1)
+	task.AvoidRepeat = true
+	methods, err := task.Rank(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	task.chose(methods[0])
+	ranked, err := task.Rank(newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ranked[len(ranked)-1] != methods[0] {
+		t.Fatalf("expected %s to be ranked last, got %s", methods[0].Name, ranked[len(ranked)-1].Name)
+	}
+}
+
+func TestCurves(t *testing.T) {
+	tests := []struct {
+		name     string
+		curve    Curve
+		x        float64
+		expected float64
+	}{
+		{name: "linear", curve: Curve{Type: Linear, Slope: 2, Intercept: 1}, x: 3, expected: 7},
+		{name: "linear without a slope", curve: Curve{Type: Linear, Intercept: 1}, x: 3, expected: 4},
+		{name: "logistic at the midpoint", curve: Curve{Type: Logistic, Midpoint: 2}, x: 2, expected: 0.5},
+		{name: "logistic far above the midpoint", curve: Curve{Type: Logistic, Midpoint: 2, Steepness: 10}, x: 5, expected: 1},
+		{name: "logistic far below the midpoint", curve: Curve{Type: Logistic, Midpoint: 2, Steepness: 10}, x: -1, expected: 0},
+		{name: "step below the threshold", curve: Curve{Type: Step, Threshold: 3, Low: 0.1, High: 0.9}, x: 2, expected: 0.1},
+		{name: "step at the threshold", curve: Curve{Type: Step, Threshold: 3, Low: 0.1, High: 0.9}, x: 3, expected: 0.9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.curve.Validate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual := test.curve.Apply(test.x); math.Abs(actual-test.expected) > 1e-9 {
+				t.Fatalf("expected %s of %v to be %v, got %v", test.curve.String(), test.x, test.expected, actual)
+			}
+		})
+	}
+	if (&Curve{Type: "cubic"}).Validate() == nil {
+		t.Fatal("expected an unknown curve to be rejected")
+	}
+}
+
+// scored returns a method scored by the utility
+func scored(name string, utility Utility) *Method {
+	m := method(name)
+	m.Score = utility
+	return m
+}
+
+func rank(t *testing.T, task *CompoundTask, state *State) []string {
+	t.Helper()
+	methods, err := task.Rank(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranked := make([]string, 0, len(methods))
+	for _, method := range methods {
+		ranked = append(ranked, method.Name)
+	}
+	return ranked
+}
+
+func TestUtilitySelectionRanksTheMethodsByScore(t *testing.T) {
+	state := newState()
+	err := (&Effect{Operation: SetProperty, Property: "Customers", Value: 3}).Apply(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &CompoundTask{TaskName: "Sell", Selection: SelectUtility, Methods: []*Method{
+		scored("Idle", Utility{Value: 0.5}),
+		scored("Shout", Utility{Considerations: []*Consideration{
+			{Property: "Customers", Curve: Curve{Type: Linear, Slope: 0.1}},
+			{Property: "Customers", Curve: Curve{Type: Step, Threshold: 1, High: 2}},
+		}}),
+		scored("Haggle", Utility{Scorer: func(state *State) (float64, error) {
+			customers, err := state.Number("Customers")
+			return customers / 4, err
+		}}),
+	}}
+	if ranked := rank(t, task, state); fmt.Sprint(ranked) != "[Haggle Shout Idle]" {
+		t.Fatalf("expected Haggle (0.75), Shout (0.6) then Idle (0.5), got %v", ranked)
+	}
+	scores := task.Scores()
+	if len(scores) != 3 || scores[1].Method != "Shout" || math.Abs(scores[1].Score-0.6) > 1e-9 {
+		t.Fatalf("expected the score of each method, got %v", scores)
+	}
+}
+
+func TestUtilitySelectionDropsMethodsThatCanNotBeScored(t *testing.T) {
+	task := &CompoundTask{TaskName: "Sell", Selection: SelectUtility, Methods: []*Method{
+		scored("Shout", Utility{Considerations: []*Consideration{{Property: "Customers", Curve: Curve{Type: Linear}}}}),
+		scored("Haggle", Utility{Scorer: func(state *State) (float64, error) {
+			return 0, errors.New("no customer")
+		}}),
+		scored("Idle", Utility{Value: 0.5}),
+	}}
+	if ranked := rank(t, task, newState()); fmt.Sprint(ranked) != "[Idle]" {
+		t.Fatalf("expected only Idle to be ranked, got %v", ranked)
+	}
+}
+
+func TestWeightedSelectionNeverDrawsAMethodOfWeightZero(t *testing.T) {
+	task := weightedTask(5, 0, 1, 0)
+	for i := 0; i < 20; i++ {
+		methods, err := task.Rank(newState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(methods) != 1 || methods[0].Name != "B" {
+			t.Fatalf("expected only the method of weight 1 to be drawn, got %d methods", len(methods))
+		}
+	}
+}
+
+func TestWeightedSelectionFailsWhenEveryMethodWeighsZero(t *testing.T) {
+	_, err := weightedTask(5, 0, 0).Rank(newState())
+	if err == nil {
+		t.Fatal("expected drawing from methods that all weigh zero to fail")
+	}
+}
@@ -25,6 +25,9 @@ func LoadConditions(cfg *config.Config) (engine.Conditions, error) {
 	conditionsPath := filepath.Join(cfg.AssetRoot, cfg.ConditionPath)
 	conditions := make(engine.Conditions)
 	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if info.IsDir() {
 			return nil
 		}
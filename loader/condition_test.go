@@ -0,0 +1,36 @@
+package loader
+
+import (
+	"github.com/cory-johannsen/gohtn/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConditionsReportsAMissingPath(t *testing.T) {
+	cfg := &config.Config{AssetRoot: t.TempDir(), ConditionPath: "conditions"}
+	_, err := LoadConditions(cfg)
+	if err == nil {
+		t.Fatal("expected an error loading conditions from a missing path")
+	}
+}
+
+func TestLoadConditions(t *testing.T) {
+	cfg := &config.Config{AssetRoot: t.TempDir(), ConditionPath: "conditions"}
+	dir := filepath.Join(cfg.AssetRoot, cfg.ConditionPath, string(Flag))
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "IsOpen.json"), []byte(`{"value": true}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditions, err := LoadConditions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := conditions["IsOpen"]; !ok {
+		t.Fatalf("expected the IsOpen condition, got %v", conditions)
+	}
+}
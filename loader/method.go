@@ -8,37 +8,51 @@ import (
 	"github.com/cory-johannsen/gohtn/gohtn"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// MethodSpec declares a Method.  Ordering lists ["before", "after"] pairs of task names, and Score is a number, a list
+// of considerations or the name of a scorer registered with the domain.
 type MethodSpec struct {
-	Name       string   `json:"name"`
-	Conditions []string `json:"conditions"`
-	Tasks      []string `json:"tasks"`
+	Name       string        `json:"name"`
+	Conditions []string      `json:"conditions"`
+	Tasks      []string      `json:"tasks"`
+	Ordering   [][]string    `json:"ordering,omitempty"`
+	Unordered  bool          `json:"unordered,omitempty"`
+	Parallel   bool          `json:"parallel,omitempty"`
+	Join       gohtn.Join    `json:"join,omitempty"`
+	Cost       gohtn.Cost    `json:"cost,omitempty"`
+	Score      gohtn.Utility `json:"score,omitempty"`
+	Weight     float64       `json:"weight,omitempty"`
 }
 
-func LoadMethods(cfg *config.Config, taskLoader *TaskLoader, htnEngine *engine.Engine) (engine.Methods, error) {
+// LoadMethodSpecs reads the method specs, keyed by file name without the extension as compound tasks refer to them
+func LoadMethodSpecs(cfg *config.Config) (map[string]*MethodSpec, error) {
 	methodsPath := fmt.Sprintf("%s/%s", cfg.AssetRoot, cfg.MethodPath)
-	methods := make(engine.Methods)
+	specs := make(map[string]*MethodSpec)
 	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		if info.IsDir() {
 			return nil
 		}
-		methodName := info.Name()
-		method, err := LoadMethod(cfg, path, taskLoader, htnEngine)
+		methodName := strings.TrimSuffix(info.Name(), ".json")
+		spec, err := LoadMethodSpec(path)
 		if err != nil {
 			return err
 		}
-		methods[methodName] = method
+		specs[methodName] = spec
 		return nil
 	}
 	err := filepath.Walk(methodsPath, walkFn)
 	if err != nil {
 		return nil, fmt.Errorf("error walking the path %q: %v", methodsPath, err)
 	}
-	return methods, nil
+	return specs, nil
 }
 
-func LoadMethod(cfg *config.Config, path string, taskLoader *TaskLoader, htnEngine *engine.Engine) (*gohtn.Method, error) {
+func LoadMethodSpec(path string) (*MethodSpec, error) {
 	spec := &MethodSpec{}
 	buffer, err := os.ReadFile(path)
 	if err != nil {
@@ -48,33 +62,72 @@ func LoadMethod(cfg *config.Config, path string, taskLoader *TaskLoader, htnEngi
 	if err != nil {
 		return nil, err
 	}
+	return spec, nil
+}
+
+// LoadMethod instantiates a Method for the Agent, binding its subtasks to the Agent's task resolvers
+func (l *TaskLoader) LoadMethod(spec *MethodSpec, domain *engine.Domain, agent *engine.Agent) (*gohtn.Method, error) {
 	method := &gohtn.Method{
 		Name:          spec.Name,
 		Conditions:    make([]gohtn.Condition, 0),
 		TaskResolvers: make(gohtn.TaskResolvers),
+		Tasks:         spec.Tasks,
+		Ordering:      make([]gohtn.Ordering, 0),
+		Unordered:     spec.Unordered,
+		Parallel:      spec.Parallel,
+		Join:          spec.Join,
+		Cost:          spec.Cost,
+		Score:         spec.Score,
+		Weight:        spec.Weight,
 	}
-	for _, conditionName := range spec.Conditions {
-		condition, ok := htnEngine.Conditions[conditionName]
+	// the method score may name a scoring function registered with the domain
+	if len(spec.Score.ScorerName) > 0 {
+		scorer, ok := domain.Scorers[spec.Score.ScorerName]
 		if !ok {
-			return nil, fmt.Errorf("unknown condition: %s", conditionName)
+			return nil, fmt.Errorf("method %s scorer %s not found", spec.Name, spec.Score.ScorerName)
+		}
+		method.Score.Scorer = scorer
+	}
+	err := method.Score.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("method %s score: %w", spec.Name, err)
+	}
+	for _, conditionName := range spec.Conditions {
+		condition, err := resolveCondition(conditionName, domain)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", spec.Name, err)
 		}
 		method.Conditions = append(method.Conditions, condition)
 	}
-	for _, taskName := range spec.Tasks {
-		taskResolver, ok := htnEngine.TaskResolvers[taskName]
+	// tasks are referenced by name, with the variables that ground a parameterized task, e.g. Greet(?customer)
+	for _, call := range spec.Tasks {
+		taskName, _, err := gohtn.ParseCall(call)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %w", spec.Name, err)
+		}
+		taskResolver, ok := agent.TaskResolvers[taskName]
 		if !ok {
-			taskSpec, ok := taskLoader.Specs[taskName]
+			taskSpec, ok := l.Specs[taskName]
 			if !ok {
 				return nil, fmt.Errorf("unknown taskResolver spec: %s", taskName)
 			}
-			loadedTask, err := taskLoader.LoadTask(cfg, taskSpec, htnEngine)
+			loadedTask, err := l.LoadTask(taskSpec, domain, agent)
 			if err != nil {
 				return nil, err
 			}
 			taskResolver = loadedTask
-			htnEngine.TaskResolvers[taskName] = taskResolver
 		}
-		method.TaskResolvers[taskName] = taskResolver
+		method.TaskResolvers[call] = taskResolver
+	}
+	for _, pair := range spec.Ordering {
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("method %s ordering %v must name exactly two tasks", spec.Name, pair)
+		}
+		method.Ordering = append(method.Ordering, gohtn.Ordering{Before: pair[0], After: pair[1]})
+	}
+	err = method.Validate()
+	if err != nil {
+		return nil, err
 	}
 	return method, nil
 }
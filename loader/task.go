@@ -7,9 +7,10 @@ import (
 	"github.com/cory-johannsen/gohtn/config"
 	"github.com/cory-johannsen/gohtn/engine"
 	"github.com/cory-johannsen/gohtn/gohtn"
-	"log"
+	"github.com/cory-johannsen/gohtn/logging"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type TaskType string
@@ -20,18 +21,55 @@ const (
 	Goal      TaskType = "goal"
 )
 
+// ResetSpec declares the reset policy of a task.  Type is one of never, onSuccess, afterTicks or onCondition, and
+// Condition names the condition that resets the task.
+type ResetSpec struct {
+	Type      gohtn.ResetType `json:"type"`
+	Ticks     int64           `json:"ticks,omitempty"`
+	Condition string          `json:"condition,omitempty"`
+}
+
+// DecoratorSpec declares a decorator wrapping a task, with Until naming a condition and a Duration such as "1.5s"
+type DecoratorSpec struct {
+	Type     gohtn.DecoratorType `json:"type"`
+	Count    int                 `json:"count,omitempty"`
+	Until    string              `json:"until,omitempty"`
+	Ticks    int64               `json:"ticks,omitempty"`
+	Duration string              `json:"duration,omitempty"`
+}
+
+// TaskSpec declares a task.  The preconditions of a primitive task are conditions, those of a compound task are
+// methods, and those of a goal task are the tasks that must complete.
 type TaskSpec struct {
-	Preconditions []string `json:"preconditions"`
-	Complete      bool     `json:"complete,omitempty"`
-	Action        string   `json:"action,omitempty"`
-	TaskName      string   `json:"name"`
-	TaskType      TaskType `json:"type,omitempty"`
+	Preconditions []string         `json:"preconditions"`
+	Complete      bool             `json:"complete,omitempty"`
+	Action        string           `json:"action,omitempty"`
+	Compensation  string           `json:"compensation,omitempty"`
+	TaskName      string           `json:"name"`
+	TaskType      TaskType         `json:"type,omitempty"`
+	Effects       []*gohtn.Effect  `json:"effects,omitempty"`
+	ApplyEffects  bool             `json:"applyEffects,omitempty"`
+	Cost          gohtn.Cost       `json:"cost,omitempty"`
+	Reset         *ResetSpec       `json:"reset,omitempty"`
+	Parameters    []string         `json:"parameters,omitempty"`
+	Conditions    []string         `json:"conditions,omitempty"`
+	Tasks         []string         `json:"tasks,omitempty"`
+	MaxSteps      int              `json:"maxSteps,omitempty"`
+	Selection     gohtn.Selection  `json:"selection,omitempty"`
+	AvoidRepeat   bool             `json:"avoidRepeat,omitempty"`
+	Decorators    []*DecoratorSpec `json:"decorators,omitempty"`
 }
 
+// TaskLoader compiles the specs of a domain once, and instantiates them for every Agent that runs it
 type TaskLoader struct {
-	Specs map[string]*TaskSpec
+	Specs       map[string]*TaskSpec
+	MethodSpecs map[string]*MethodSpec
+	GraphSpec   *TaskGraphSpec
+	Logger      logging.Logger
 }
 
+var _ engine.Instantiator = &TaskLoader{}
+
 func initTask(taskType TaskType) (gohtn.Task, error) {
 	switch taskType {
 	case Primitive:
@@ -44,63 +82,143 @@ func initTask(taskType TaskType) (gohtn.Task, error) {
 	return nil, errors.New("invalid task type")
 }
 
-func (l *TaskLoader) LoadTaskResolvers(cfg *config.Config, engine *engine.Engine) (map[string]gohtn.TaskResolver, error) {
-	if l.Specs == nil {
-		l.Specs = make(map[string]*TaskSpec)
+// LoadDomain compiles the assets named by the config into a Domain using the given conditions and actions.  The logger
+// may be nil to load silently.
+func LoadDomain(cfg *config.Config, conditions engine.Conditions, actorConditions engine.ActorConditions, actions engine.Actions, logger logging.Logger) (*engine.Domain, error) {
+	taskLoader := &TaskLoader{Logger: logger}
+	err := taskLoader.LoadSpecs(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return &engine.Domain{
+		Conditions:      conditions,
+		ActorConditions: actorConditions,
+		Actions:         actions,
+		Instantiator:    taskLoader,
+	}, nil
+}
+
+// resolveCondition looks up a condition reference.  A reference with a variable argument, e.g. IsNPC(?customer), names
+// an actor condition and resolves to a VariableCondition on that variable.
+func resolveCondition(reference string, domain *engine.Domain) (gohtn.Condition, error) {
+	name, variables, err := gohtn.ParseCall(reference)
+	if err != nil {
+		return nil, err
+	}
+	if variables == nil {
+		condition, ok := domain.Conditions[name]
+		if !ok {
+			return nil, fmt.Errorf("condition %s not found", name)
+		}
+		return condition, nil
+	}
+	if len(variables) != 1 {
+		return nil, fmt.Errorf("actor condition %s takes exactly one variable", reference)
+	}
+	actorCondition, ok := domain.ActorConditions[name]
+	if !ok {
+		return nil, fmt.Errorf("actor condition %s not found", name)
+	}
+	return &gohtn.VariableCondition{
+		Variable:  variables[0],
+		Condition: actorCondition,
+	}, nil
+}
+
+func validateParameters(spec *TaskSpec) error {
+	for _, parameter := range spec.Parameters {
+		if !gohtn.IsVariable(parameter) {
+			return fmt.Errorf("task %s parameter %s is not a variable", spec.TaskName, parameter)
+		}
+	}
+	return nil
+}
+
+// LoadSpecs reads the task, method and task graph specs
+func (l *TaskLoader) LoadSpecs(cfg *config.Config) error {
+	l.Specs = make(map[string]*TaskSpec)
+	logger := logging.OrNop(l.Logger)
 
 	// filepath.Walk traverses in lexicographical order, but the taskResolvers need to be loaded primitive, compound, then goal to satisfy dependencies in order
 	// load the primitive task specs
-	log.Printf("loading primitive task specs")
+	logger.Debug("loading primitive task specs")
 	primitivePath := fmt.Sprintf("%s/%s/%s", cfg.AssetRoot, cfg.TaskPath, Primitive)
-	primitiveTasks, err := loadTaskSpecs(Primitive, primitivePath)
+	primitiveTasks, err := loadTaskSpecs(Primitive, primitivePath, logger)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for name, primitiveTask := range primitiveTasks {
 		l.Specs[name] = primitiveTask
 	}
 	// load the compound task specs
-	log.Printf("loading compound task specs")
+	logger.Debug("loading compound task specs")
 	compoundPath := fmt.Sprintf("%s/%s/%s", cfg.AssetRoot, cfg.TaskPath, Compound)
-	compoundTasks, err := loadTaskSpecs(Compound, compoundPath)
+	compoundTasks, err := loadTaskSpecs(Compound, compoundPath, logger)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for name, compoundTask := range compoundTasks {
 		l.Specs[name] = compoundTask
 	}
 	// load the goal task specs
-	log.Printf("loading goal task specs")
+	logger.Debug("loading goal task specs")
 	goalPath := fmt.Sprintf("%s/%s/%s", cfg.AssetRoot, cfg.TaskPath, Goal)
-	goalTasks, err := loadTaskSpecs(Goal, goalPath)
+	goalTasks, err := loadTaskSpecs(Goal, goalPath, logger)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	for name, goalTask := range goalTasks {
 		l.Specs[name] = goalTask
 	}
 
-	// iterate the specs and load the taskResolvers
-	log.Printf("loading taskResolvers from specs")
-	taskResolvers := make(map[string]gohtn.TaskResolver)
+	logger.Debug("loading method specs")
+	l.MethodSpecs, err = LoadMethodSpecs(cfg)
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("loading task graph spec")
+	l.GraphSpec, err = LoadTaskGraphSpec(cfg)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Instantiate creates the task resolvers and task graph of the Agent.  Tasks are instantiated the first time they
+// are resolved, into the Agent's own task instances.
+func (l *TaskLoader) Instantiate(domain *engine.Domain, agent *engine.Agent) error {
+	logger := logging.OrNop(agent.Logger)
+	logger.Debug("loading task resolvers")
 	for _, taskSpec := range l.Specs {
-		taskResolver, err := l.LoadTask(cfg, taskSpec, engine)
+		_, err := l.LoadTask(taskSpec, domain, agent)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		taskResolvers[taskSpec.TaskName] = taskResolver
 	}
-	return taskResolvers, nil
+	logger.Debug("loading task graph")
+	taskGraph, err := LoadTaskGraph(l.GraphSpec, agent)
+	if err != nil {
+		return err
+	}
+	agent.Graph = taskGraph
+	return nil
 }
 
-func loadTaskSpecs(taskType TaskType, path string) (map[string]*TaskSpec, error) {
+func loadTaskSpecs(taskType TaskType, path string, logger logging.Logger) (map[string]*TaskSpec, error) {
 	specs := make(map[string]*TaskSpec)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		// a domain may have no tasks of the type
+		return specs, nil
+	}
 	walkFn := func(path string, info os.FileInfo, err error) error {
-		if info == nil || info.IsDir() {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
 			return nil
 		}
-		log.Printf("loading %s task spec %s", taskType, path)
+		logger.Debug("loading task spec", logging.F("type", taskType), logging.F("path", path))
 		spec, err := loadTaskSpec(taskType, path)
 		if err != nil {
 			return err
@@ -129,85 +247,209 @@ func loadTaskSpec(taskType TaskType, path string) (*TaskSpec, error) {
 	return spec, nil
 }
 
-func (l *TaskLoader) LoadTask(cfg *config.Config, spec *TaskSpec, engine *engine.Engine) (gohtn.TaskResolver, error) {
-	task, err := initTask(spec.TaskType)
-	if err != nil {
-		return nil, err
-	}
+// LoadTask registers the resolver of the task with the Agent.  The resolver builds a new task the first time it is
+// called, so an instantiation that failed starts over from the spec when it is retried.
+func (l *TaskLoader) LoadTask(spec *TaskSpec, domain *engine.Domain, agent *engine.Agent) (gohtn.TaskResolver, error) {
 	resolver := func() (gohtn.Task, error) {
-		existing, ok := engine.Tasks[spec.TaskName]
+		existing, ok := agent.Tasks[spec.TaskName]
 		if ok {
 			return existing, nil
 		}
-		log.Printf("instantiating task %s", spec.TaskName)
-		t, err := l.instantiateTask(cfg, task, spec, engine)
+		logging.OrNop(agent.Logger).Debug("instantiating task", logging.Task(spec.TaskName))
+		task, err := initTask(spec.TaskType)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", spec.TaskName, err)
+		}
+		t, err := l.instantiateTask(task, spec, domain, agent)
+		if err != nil {
+			return nil, err
+		}
+		t, err = decorate(t, spec, domain, agent)
 		if err != nil {
 			return nil, err
 		}
-		engine.Tasks[spec.TaskName] = t
+		agent.Tasks[spec.TaskName] = t
 		return t, nil
 	}
-	engine.TaskResolvers[spec.TaskName] = resolver
+	agent.TaskResolvers[spec.TaskName] = resolver
 	return resolver, nil
 }
 
-func (l *TaskLoader) instantiateTask(cfg *config.Config, task gohtn.Task, spec *TaskSpec, engine *engine.Engine) (gohtn.Task, error) {
-	var action gohtn.Action
+func (l *TaskLoader) instantiateTask(task gohtn.Task, spec *TaskSpec, domain *engine.Domain, agent *engine.Agent) (gohtn.Task, error) {
+	var action gohtn.ContextAction
 	if len(spec.Action) > 0 {
 		// the action is a name used to resolve the function from the action registry
-		foundAction, ok := engine.Actions[spec.Action]
+		foundAction, ok := domain.Actions[spec.Action]
 		if !ok {
 			return nil, fmt.Errorf("task %s action %s not found", spec.TaskName, spec.Action)
 		}
 		action = foundAction
 	}
+	resetPolicy, err := loadResetPolicy(spec, domain)
+	if err != nil {
+		return nil, err
+	}
+	err = validateParameters(spec)
+	if err != nil {
+		return nil, err
+	}
 	switch spec.TaskType {
 	case Primitive:
 		// primitive task preconditions are Conditions
 		for _, preconditionName := range spec.Preconditions {
-			precondition, ok := engine.Conditions[preconditionName]
-			if !ok {
-				return nil, fmt.Errorf("task %s precondition %s not found", spec.TaskName, preconditionName)
+			precondition, err := resolveCondition(preconditionName, domain)
+			if err != nil {
+				return nil, fmt.Errorf("task %s precondition: %w", spec.TaskName, err)
 			}
 			task.(*gohtn.PrimitiveTask).Preconditions = append(task.(*gohtn.PrimitiveTask).Preconditions, precondition)
 		}
+		// primitive task effects are declared inline
+		for _, effect := range spec.Effects {
+			err := effect.Validate()
+			if err != nil {
+				return nil, fmt.Errorf("task %s effect: %w", spec.TaskName, err)
+			}
+		}
 		task.(*gohtn.PrimitiveTask).Action = action
+		// the compensating action undoes the action when a failed plan is rolled back
+		if len(spec.Compensation) > 0 {
+			compensation, ok := domain.Actions[spec.Compensation]
+			if !ok {
+				return nil, fmt.Errorf("task %s compensation %s not found", spec.TaskName, spec.Compensation)
+			}
+			task.(*gohtn.PrimitiveTask).Compensation = compensation
+		}
 		task.(*gohtn.PrimitiveTask).TaskName = spec.TaskName
+		task.(*gohtn.PrimitiveTask).Effects = spec.Effects
+		task.(*gohtn.PrimitiveTask).ApplyEffects = spec.ApplyEffects
+		task.(*gohtn.PrimitiveTask).Cost = spec.Cost
+		task.(*gohtn.PrimitiveTask).ResetPolicy = resetPolicy
+		task.(*gohtn.PrimitiveTask).TaskParameters = spec.Parameters
 	case Compound:
 		// compound task preconditions are Methods
 		for _, methodName := range spec.Preconditions {
-			log.Printf("task %s fetching method %s", spec.TaskName, methodName)
-			method, ok := engine.Methods[methodName]
+			logging.OrNop(agent.Logger).Debug("fetching method", logging.Task(spec.TaskName), logging.Method(methodName))
+			method, ok := agent.Methods[methodName]
 			if !ok {
-				// direct load the method
-				log.Printf("task %s method %s not found, loading it", spec.TaskName, methodName)
-				methodPath := fmt.Sprintf("%s/%s/%s.json", cfg.AssetRoot, cfg.MethodPath, methodName)
-				loadedMethod, err := LoadMethod(cfg, methodPath, l, engine)
+				// instantiate the method from its spec
+				logging.OrNop(agent.Logger).Debug("method not found, loading it", logging.Task(spec.TaskName), logging.Method(methodName))
+				methodSpec, ok := l.MethodSpecs[methodName]
+				if !ok {
+					return nil, fmt.Errorf("task %s method %s not found", spec.TaskName, methodName)
+				}
+				loadedMethod, err := l.LoadMethod(methodSpec, domain, agent)
 				if err != nil {
 					return nil, err
 				}
-				engine.Methods[methodName] = loadedMethod
+				agent.Methods[methodName] = loadedMethod
 				method = loadedMethod
 			}
 			task.(*gohtn.CompoundTask).Methods = append(task.(*gohtn.CompoundTask).Methods, method)
-			task.(*gohtn.CompoundTask).TaskName = spec.TaskName
 		}
+		err := spec.Selection.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", spec.TaskName, err)
+		}
+		task.(*gohtn.CompoundTask).Selection = spec.Selection
+		task.(*gohtn.CompoundTask).Random = agent.Random
+		task.(*gohtn.CompoundTask).AvoidRepeat = spec.AvoidRepeat
+		task.(*gohtn.CompoundTask).TaskName = spec.TaskName
+		task.(*gohtn.CompoundTask).ResetPolicy = resetPolicy
+		task.(*gohtn.CompoundTask).TaskParameters = spec.Parameters
 	case Goal:
 		// goal task preconditions are TaskConditions
 		for _, taskName := range spec.Preconditions {
-			taskResolver, ok := engine.TaskResolvers[taskName]
+			taskResolver, ok := agent.TaskResolvers[taskName]
 			if !ok {
 				return nil, fmt.Errorf("task %s precondition task %s not found", spec.TaskName, taskName)
 			}
-			task, err := taskResolver()
+			conditionTask, err := taskResolver()
 			if err != nil {
 				return nil, err
 			}
 			task.(*gohtn.GoalTask).Preconditions = append(task.(*gohtn.GoalTask).Preconditions, &gohtn.TaskCondition{
-				Task: task,
+				Task: conditionTask,
 			})
-			task.(*gohtn.GoalTask).TaskName = spec.TaskName
 		}
+		// goal conditions describe the desired state
+		for _, conditionName := range spec.Conditions {
+			condition, err := resolveCondition(conditionName, domain)
+			if err != nil {
+				return nil, fmt.Errorf("task %s condition: %w", spec.TaskName, err)
+			}
+			task.(*gohtn.GoalTask).Preconditions = append(task.(*gohtn.GoalTask).Preconditions, condition)
+		}
+		// goal tasks are the candidates the planner may use to reach the desired state
+		for _, taskName := range spec.Tasks {
+			taskResolver, ok := agent.TaskResolvers[taskName]
+			if !ok {
+				return nil, fmt.Errorf("task %s candidate task %s not found", spec.TaskName, taskName)
+			}
+			candidate, err := taskResolver()
+			if err != nil {
+				return nil, err
+			}
+			task.(*gohtn.GoalTask).Tasks = append(task.(*gohtn.GoalTask).Tasks, candidate)
+		}
+		task.(*gohtn.GoalTask).MaxSteps = spec.MaxSteps
+		task.(*gohtn.GoalTask).TaskName = spec.TaskName
+	}
+	return task, nil
+}
+
+// decorate wraps the task in its decorators, in the order they are listed, so the last decorator is the
+// outermost.  Durations are measured on the Clock of the Agent.
+func decorate(task gohtn.Task, spec *TaskSpec, domain *engine.Domain, agent *engine.Agent) (gohtn.Task, error) {
+	for _, decoratorSpec := range spec.Decorators {
+		decorator := &gohtn.Decorator{
+			Type:  decoratorSpec.Type,
+			Task:  task,
+			Count: decoratorSpec.Count,
+			Ticks: decoratorSpec.Ticks,
+			Clock: agent.Clock,
+		}
+		if len(decoratorSpec.Until) > 0 {
+			condition, err := resolveCondition(decoratorSpec.Until, domain)
+			if err != nil {
+				return nil, fmt.Errorf("task %s %s decorator: %w", spec.TaskName, decoratorSpec.Type, err)
+			}
+			decorator.Until = condition
+		}
+		if len(decoratorSpec.Duration) > 0 {
+			duration, err := time.ParseDuration(decoratorSpec.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("task %s %s decorator: %w", spec.TaskName, decoratorSpec.Type, err)
+			}
+			decorator.Duration = duration
+		}
+		err := decorator.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("task %s: %w", spec.TaskName, err)
+		}
+		task = decorator
 	}
 	return task, nil
 }
+
+// loadResetPolicy builds a fresh ResetPolicy for a task instance from its spec, resolving the named condition
+func loadResetPolicy(spec *TaskSpec, domain *engine.Domain) (*gohtn.ResetPolicy, error) {
+	if spec.Reset == nil {
+		return nil, nil
+	}
+	policy := &gohtn.ResetPolicy{
+		Type:  spec.Reset.Type,
+		Ticks: spec.Reset.Ticks,
+	}
+	if len(spec.Reset.Condition) > 0 {
+		condition, ok := domain.Conditions[spec.Reset.Condition]
+		if !ok {
+			return nil, fmt.Errorf("task %s reset condition %s not found", spec.TaskName, spec.Reset.Condition)
+		}
+		policy.Condition = condition
+	}
+	err := policy.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("task %s: %w", spec.TaskName, err)
+	}
+	return policy, nil
+}
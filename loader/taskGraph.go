@@ -18,7 +18,7 @@ type TaskGraphSpec struct {
 	Root *TaskNodeSpec `json:"root"`
 }
 
-func LoadTaskGraph(cfg *config.Config, engine *engine.Engine) (*gohtn.TaskGraph, error) {
+func LoadTaskGraphSpec(cfg *config.Config) (*TaskGraphSpec, error) {
 	taskGraphPath := fmt.Sprintf("%s/%s", cfg.AssetRoot, cfg.TaskGraphPath)
 	spec := &TaskGraphSpec{}
 	buffer, err := os.ReadFile(taskGraphPath)
@@ -29,25 +29,31 @@ func LoadTaskGraph(cfg *config.Config, engine *engine.Engine) (*gohtn.TaskGraph,
 	if err != nil {
 		return nil, err
 	}
-	root, err := loadTaskNode(spec.Root, engine)
+	return spec, nil
+}
+
+// LoadTaskGraph builds the task graph of the Agent from the spec, using the Agent's task resolvers
+func LoadTaskGraph(spec *TaskGraphSpec, agent *engine.Agent) (*gohtn.TaskGraph, error) {
+	taskGraph := &gohtn.TaskGraph{}
+	if spec == nil || spec.Root == nil {
+		return taskGraph, nil
+	}
+	root, err := loadTaskNode(spec.Root, agent)
 	if err != nil {
 		return nil, err
 	}
-	taskGraph := &gohtn.TaskGraph{
-		Root: root,
-	}
-
+	taskGraph.Root = root
 	return taskGraph, nil
 }
 
-func loadTaskNode(spec *TaskNodeSpec, engine *engine.Engine) (*gohtn.TaskNode, error) {
-	taskResolver, ok := engine.TaskResolvers[spec.Task]
+func loadTaskNode(spec *TaskNodeSpec, agent *engine.Agent) (*gohtn.TaskNode, error) {
+	taskResolver, ok := agent.TaskResolvers[spec.Task]
 	if !ok {
 		return nil, fmt.Errorf("taskResolver %s not found", spec.Task)
 	}
 	children := make([]*gohtn.TaskNode, 0)
 	for _, childSpec := range spec.Children {
-		child, err := loadTaskNode(childSpec, engine)
+		child, err := loadTaskNode(childSpec, agent)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"context"
+	"github.com/cory-johannsen/gohtn/engine"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"testing"
+)
+
+// greetDomain returns a Domain with a Greet task that requires the shop to be open and whose action succeeds
+func greetDomain() *engine.Domain {
+	loader := &TaskLoader{Specs: map[string]*TaskSpec{
+		"Greet": {TaskName: "Greet", TaskType: Primitive, Action: "Greet", Preconditions: []string{"IsOpen"}},
+	}}
+	return &engine.Domain{
+		Conditions: engine.Conditions{"IsOpen": &gohtn.FlagCondition{Value: true}},
+		Actions: engine.Actions{"Greet": func(ctx context.Context, state *gohtn.State) (gohtn.TaskStatus, error) {
+			return gohtn.Succeeded, nil
+		}},
+		Instantiator: loader,
+	}
+}
+
+func newState() *gohtn.State {
+	return &gohtn.State{Properties: make(map[string]any), Sensors: make(map[string]any)}
+}
+
+func TestEachAgentGetsItsOwnTaskInstances(t *testing.T) {
+	htnEngine := &engine.Engine{Domain: greetDomain()}
+	greets := make([]gohtn.Task, 0, 2)
+	for _, name := range []string{"Vendor", "Guard"} {
+		agent, err := htnEngine.AddAgent(name, newState())
+		if err != nil {
+			t.Fatal(err)
+		}
+		greet, err := agent.TaskResolvers["Greet"]()
+		if err != nil {
+			t.Fatal(err)
+		}
+		greets = append(greets, greet)
+	}
+	if greets[0] == greets[1] {
+		t.Fatal("expected the agents to get separate instances of the task")
+	}
+	_, err := greets[0].Execute(context.Background(), newState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if greets[0].Status() != gohtn.Succeeded || greets[1].Status() != gohtn.Pending {
+		t.Fatalf("expected only the greeting of the vendor to succeed, got %s and %s", greets[0].Status(), greets[1].Status())
+	}
+}
+
+func TestARetriedInstantiationStartsOverFromTheSpec(t *testing.T) {
+	domain := greetDomain()
+	loader := domain.Instantiator.(*TaskLoader)
+	loader.Specs["Greet"].Compensation = "Apologize"
+	agent := &engine.Agent{
+		Name:          "Vendor",
+		TaskResolvers: make(gohtn.TaskResolvers),
+		Tasks:         make(gohtn.Tasks),
+		Methods:       make(engine.Methods),
+	}
+	resolver, err := loader.LoadTask(loader.Specs["Greet"], domain, agent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = resolver()
+	if err == nil {
+		t.Fatal("expected the missing compensation to fail the instantiation")
+	}
+	domain.Actions["Apologize"] = domain.Actions["Greet"]
+	greet, err := resolver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preconditions := greet.(*gohtn.PrimitiveTask).Preconditions; len(preconditions) != 1 {
+		t.Fatalf("expected a single precondition, got %v", preconditions)
+	}
+	if again, err := resolver(); err != nil || again != greet {
+		t.Fatalf("expected the agent to keep its instance, got %v", err)
+	}
+}
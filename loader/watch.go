@@ -0,0 +1,127 @@
+package loader
+
+import (
+	"context"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/config"
+	"github.com/cory-johannsen/gohtn/engine"
+	"github.com/cory-johannsen/gohtn/logging"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultWatchInterval is the time between two scans of the assets when the Watcher does not specify one
+const DefaultWatchInterval = time.Second
+
+// Compiler builds a Domain from the assets named by the config, typically by loading the conditions, adding those
+// registered in code, and calling LoadDomain
+type Compiler func(cfg *config.Config) (*engine.Domain, error)
+
+// Watcher polls the asset files every Interval and reloads the Domain of the Engine once a change has settled
+type Watcher struct {
+	Config   *config.Config
+	Compile  Compiler
+	Engine   *engine.Engine
+	Interval time.Duration
+	Logger   logging.Logger
+}
+
+// stamp identifies the version of an asset file
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch scans the assets until the context is done
+func (w *Watcher) Watch(ctx context.Context) error {
+	logger := logging.OrNop(w.Logger)
+	stamps, err := assetStamps(w.Config)
+	if err != nil {
+		return err
+	}
+	interval := w.Interval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current, err := assetStamps(w.Config)
+		if err != nil {
+			// a file may be in the middle of being replaced
+			logger.Warn("scanning assets", logging.Err(err))
+			continue
+		}
+		if !sameStamps(stamps, current) {
+			stamps = current
+			pending = true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+		logger.Info("assets changed, reloading domain")
+		err = w.Reload()
+		if err != nil {
+			logger.Error("domain reload rejected", logging.Err(err))
+		}
+	}
+}
+
+// Reload compiles the Domain from the assets and swaps it into the Engine
+func (w *Watcher) Reload() error {
+	domain, err := w.Compile(w.Config)
+	if err != nil {
+		return fmt.Errorf("compiling domain: %w", err)
+	}
+	return w.Engine.Reload(domain)
+}
+
+// assetStamps stamps every file the domain is compiled from
+func assetStamps(cfg *config.Config) (map[string]stamp, error) {
+	stamps := make(map[string]stamp)
+	walkFn := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		stamps[path] = stamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	}
+	paths := []string{
+		filepath.Join(cfg.AssetRoot, cfg.ConditionPath),
+		filepath.Join(cfg.AssetRoot, cfg.TaskPath),
+		filepath.Join(cfg.AssetRoot, cfg.MethodPath),
+		filepath.Join(cfg.AssetRoot, cfg.TaskGraphPath),
+	}
+	for _, path := range paths {
+		err := filepath.Walk(path, walkFn)
+		if err != nil {
+			return nil, fmt.Errorf("error walking the path %q: %w", path, err)
+		}
+	}
+	return stamps, nil
+}
+
+func sameStamps(a map[string]stamp, b map[string]stamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, s := range a {
+		other, ok := b[path]
+		if !ok || !other.modTime.Equal(s.modTime) || other.size != s.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// ParseLevel parses the name of a Level, e.g. "debug"
+func ParseLevel(name string) (Level, error) {
+	for level := Debug; level <= Error; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return Debug, fmt.Errorf("unknown log level %s", name)
+}
+
+// Field is a structured field attached to a log entry
+type Field struct {
+	Key   string
+	Value any
+}
+
+// F returns a Field
+func F(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Agent names the agent an entry is about
+func Agent(name string) Field {
+	return F("agent", name)
+}
+
+// Task names the task an entry is about
+func Task(name string) Field {
+	return F("task", name)
+}
+
+// Method names the method an entry is about
+func Method(name string) Field {
+	return F("method", name)
+}
+
+// Tick is the engine tick an entry was logged at
+func Tick(tick int64) Field {
+	return F("tick", tick)
+}
+
+// Err attaches an error to an entry
+func Err(err error) Field {
+	return F("error", err)
+}
+
+// Logger is a leveled structured logger.  With returns a Logger that adds the fields to every entry, so an agent can
+// hand a Logger carrying its name to everything it runs.
+type Logger interface {
+	Debug(message string, fields ...Field)
+	Info(message string, fields ...Field)
+	Warn(message string, fields ...Field)
+	Error(message string, fields ...Field)
+	Enabled(level Level) bool
+	With(fields ...Field) Logger
+}
+
+// OrNop returns the Logger, or a silent Logger when it is nil
+func OrNop(logger Logger) Logger {
+	if logger == nil {
+		return Nop
+	}
+	return logger
+}
+
+// Nop is the silent Logger used when none is injected
+var Nop Logger = nop{}
+
+type nop struct{}
+
+func (nop) Debug(string, ...Field) {}
+func (nop) Info(string, ...Field)  {}
+func (nop) Warn(string, ...Field)  {}
+func (nop) Error(string, ...Field) {}
+func (nop) Enabled(Level) bool     { return false }
+func (n nop) With(...Field) Logger { return n }
+
+// encoder writes a single entry
+type encoder func(w io.Writer, at time.Time, level Level, message string, fields []Field) error
+
+// logger writes the entries at or above its Level to a Writer shared with the loggers derived from it through With
+type logger struct {
+	writer io.Writer
+	level  Level
+	fields []Field
+	encode encoder
+	mutex  *sync.Mutex
+}
+
+// NewText returns a Logger writing entries at or above the level as lines of text, e.g.
+//
+//	2024-01-02T15:04:05.000Z info executing task agent=Vendor task=Wait
+func NewText(w io.Writer, level Level) Logger {
+	return &logger{writer: w, level: level, encode: encodeText, mutex: &sync.Mutex{}}
+}
+
+// NewJSON returns a Logger writing entries at or above the level as JSON objects, one per line, with the fields next
+// to the time, level and message
+func NewJSON(w io.Writer, level Level) Logger {
+	return &logger{writer: w, level: level, encode: encodeJSON, mutex: &sync.Mutex{}}
+}
+
+func (l *logger) Debug(message string, fields ...Field) {
+	l.log(Debug, message, fields)
+}
+
+func (l *logger) Info(message string, fields ...Field) {
+	l.log(Info, message, fields)
+}
+
+func (l *logger) Warn(message string, fields ...Field) {
+	l.log(Warn, message, fields)
+}
+
+func (l *logger) Error(message string, fields ...Field) {
+	l.log(Error, message, fields)
+}
+
+func (l *logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *logger) With(fields ...Field) Logger {
+	derived := *l
+	derived.fields = append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	return &derived
+}
+
+func (l *logger) log(level Level, message string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := append(l.fields[:len(l.fields):len(l.fields)], fields...)
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_ = l.encode(l.writer, time.Now(), level, message, all)
+}
+
+func encodeText(w io.Writer, at time.Time, level Level, message string, fields []Field) error {
+	line := strings.Builder{}
+	line.WriteString(at.UTC().Format("2006-01-02T15:04:05.000Z"))
+	line.WriteString(" ")
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(message)
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line.WriteString(fmt.Sprintf(" %s=%s", field.Key, value))
+	}
+	line.WriteString("\n")
+	_, err := io.WriteString(w, line.String())
+	return err
+}
+
+func encodeJSON(w io.Writer, at time.Time, level Level, message string, fields []Field) error {
+	entry := make(map[string]any, len(fields)+3)
+	for _, field := range fields {
+		entry[field.Key] = jsonValue(field.Value)
+	}
+	entry["time"] = at.UTC().Format(time.RFC3339Nano)
+	entry["level"] = level.String()
+	entry["message"] = message
+	buffer, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buffer, '\n'))
+	return err
+}
+
+// jsonValue keeps the values JSON can encode as they are and writes anything else, such as errors, as its string
+func jsonValue(value any) any {
+	switch v := value.(type) {
+	case nil, bool, string, int, int64, int32, uint, uint64, float64, float32:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTextWritesAnEntryPerLine(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewText(&buffer, Debug).With(Agent("Vendor"))
+	logger.Info("greeting customer", F("customer", "Player"), F("note", "big spender"))
+	logger.Error("trade failed", Task("Trade"), Err(errors.New("out of stock")))
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	expected := []string{
+		`info greeting customer agent=Vendor customer=Player note="big spender"`,
+		`error trade failed agent=Vendor task=Trade error="out of stock"`,
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %q", len(expected), buffer.String())
+	}
+	stamp := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z `)
+	for i, line := range lines {
+		if !stamp.MatchString(line) {
+			t.Fatalf("expected the line to start with the time, got %q", line)
+		}
+		if entry := stamp.ReplaceAllString(line, ""); entry != expected[i] {
+			t.Fatalf("expected %q, got %q", expected[i], entry)
+		}
+	}
+}
+
+func TestNewJSONWritesAnObjectPerLine(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewJSON(&buffer, Debug).With(Agent("Vendor"), Tick(3))
+	logger.Warn("plan execution stopped", Err(errors.New("broken")), F("score", 0.5))
+	entry := make(map[string]any)
+	err := json.Unmarshal(buffer.Bytes(), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{
+		"level":   "warn",
+		"message": "plan execution stopped",
+		"agent":   "Vendor",
+		"tick":    float64(3),
+		"error":   "broken",
+		"score":   0.5,
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Fatalf("expected %s to be %v, got %v", key, value, entry[key])
+		}
+	}
+	if _, err := time.Parse(time.RFC3339Nano, entry["time"].(string)); err != nil {
+		t.Fatalf("expected the time of the entry, got %v", entry["time"])
+	}
+	if len(entry) != len(expected)+1 {
+		t.Fatalf("expected only the time next to the fields, got %v", entry)
+	}
+}
+
+func TestEntriesBelowTheLevelAreNotWritten(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := NewText(&buffer, Warn)
+	for level, enabled := range map[Level]bool{Debug: false, Info: false, Warn: true, Error: true} {
+		if logger.Enabled(level) != enabled {
+			t.Fatalf("expected %s to be enabled %t", level, enabled)
+		}
+	}
+	logger.Debug("planning")
+	logger.Info("executing")
+	logger.Warn("no plan available")
+	if output := buffer.String(); strings.Count(output, "\n") != 1 || !strings.Contains(output, "warn no plan available") {
+		t.Fatalf("expected only the warning, got %q", output)
+	}
+	if Nop.Enabled(Error) || OrNop(nil) != Nop {
+		t.Fatal("expected a missing Logger to be silent")
+	}
+}
+
+func TestWithDoesNotChangeTheParentLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	parent := NewText(&buffer, Info).With(Agent("Vendor"))
+	parent.With(Task("Greet")).Info("greeting")
+	parent.With(Task("Trade")).Info("trading")
+	parent.Info("idle")
+	output := buffer.String()
+	if !strings.Contains(output, "trading agent=Vendor task=Trade\n") || !strings.Contains(output, "idle agent=Vendor\n") {
+		t.Fatalf("expected each derived Logger to keep its own fields, got %q", output)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("WARN")
+	if err != nil || level != Warn {
+		t.Fatalf("expected warn, got %s and %v", level, err)
+	}
+	_, err = ParseLevel("verbose")
+	if err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
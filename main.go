@@ -1,30 +1,96 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/cory-johannsen/gohtn/actor"
+	"github.com/cory-johannsen/gohtn/clock"
 	"github.com/cory-johannsen/gohtn/config"
 	"github.com/cory-johannsen/gohtn/engine"
 	"github.com/cory-johannsen/gohtn/gohtn"
 	"github.com/cory-johannsen/gohtn/loader"
-	"log"
-	"strings"
+	"github.com/cory-johannsen/gohtn/logging"
+	"github.com/cory-johannsen/gohtn/metrics"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"time"
 )
 
-func initializeEngine(cfg *config.Config) *engine.Engine {
+// newLogger builds the logger named by the config, writing text at the info level unless configured otherwise
+func newLogger(cfg *config.Config) (logging.Logger, error) {
+	level := logging.Info
+	if len(cfg.LogLevel) > 0 {
+		parsed, err := logging.ParseLevel(cfg.LogLevel)
+		if err != nil {
+			return nil, err
+		}
+		level = parsed
+	}
+	switch cfg.LogFormat {
+	case "", "text":
+		return logging.NewText(os.Stderr, level), nil
+	case "json":
+		return logging.NewJSON(os.Stderr, level), nil
+	}
+	return nil, fmt.Errorf("unknown log format %s", cfg.LogFormat)
+}
+
+// restoreSnapshot restores the engine from the snapshot file, if there is one
+func restoreSnapshot(htnEngine *engine.Engine, path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	snapshot, err := engine.ReadSnapshot(file)
+	if err != nil {
+		return err
+	}
+	return htnEngine.Restore(snapshot, nil)
+}
+
+// saveSnapshot writes a snapshot of the engine next to the file and moves it into place, so a crash while saving
+// leaves the previous snapshot intact
+func saveSnapshot(htnEngine *engine.Engine, path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	err = engine.WriteSnapshot(file, htnEngine.Snapshot())
+	if err != nil {
+		file.Close()
+		return err
+	}
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// waitUntil is the property holding the time the Wait action of an agent ends
+const waitUntil = "WaitUntil"
+
+// initializeEngine builds the engine along with the compiler of its domain, which a reload runs again
+func initializeEngine(cfg *config.Config, logger logging.Logger) (*engine.Engine, loader.Compiler) {
 
 	htnEngine := &engine.Engine{
-		Actors:        make(actor.Actors),
-		Sensors:       make(gohtn.Sensors),
-		Actions:       make(engine.Actions),
-		Conditions:    make(engine.Conditions),
-		TaskResolvers: make(gohtn.TaskResolvers),
-		Tasks:         make(gohtn.Tasks),
-		Methods:       make(engine.Methods),
-		Planner:       nil,
-		Domain:        nil,
+		Actors:  make(actor.Actors),
+		Sensors: make(gohtn.Sensors),
+		Domain:  nil,
+		Logger:  logger,
+		Clock:   clock.Real,
 	}
+	if cfg.TimeScale > 0 {
+		htnEngine.Clock = clock.NewScaled(clock.Real, cfg.TimeScale)
+	}
+	htnEngine.Events.Logger = logger
 
 	vendor := &actor.Vendor{
 		NPC: actor.NPC{
@@ -40,84 +106,81 @@ func initializeEngine(cfg *config.Config) *engine.Engine {
 	}
 	htnEngine.Actors[player.Name()] = player
 
-	log.Println("loading conditions")
-	conditions, err := loader.LoadConditions(cfg)
-	if err != nil {
-		panic(err)
-	}
-
-	conditions["AfterWorkStart"] = &gohtn.ComparisonCondition[int64]{
-		Comparison: gohtn.GTE,
-		Value:      1,
-		Property:   "HourOfDay",
-		Comparator: func(value int64, property int64, comparison gohtn.Comparison) bool {
-			return property >= value
-		},
-	}
-	conditions["BeforeWorkEnd"] = &gohtn.ComparisonCondition[int64]{
-		Comparison: gohtn.LTE,
-		Value:      14,
-		Property:   "HourOfDay",
-		Comparator: func(value int64, property int64, comparison gohtn.Comparison) bool {
-			return property <= value
+	actorConditions := make(engine.ActorConditions)
+	actorConditions["CustomerInRange"] = &gohtn.FuncActorCondition{
+		Name: "CustomerInRange",
+		Evaluator: func(a actor.Actor, state *gohtn.State) bool {
+			if a == vendor {
+				return false
+			}
+			return actor.Distance(vendor.Location(), a.Location()) <= vendor.Range
 		},
 	}
-	conditions["CustomerNotEngaged"] = &gohtn.ComparisonCondition[int64]{
-		Comparison: gohtn.EQ,
-		Value:      0,
-		Property:   "CustomersEngaged",
-		Comparator: gohtn.Int64Comparator,
-	}
-	conditions["CustomersInRange"] = &gohtn.ComparisonCondition[int]{
-		Comparison: gohtn.GT,
-		Value:      0,
-		Property:   "CustomersInRange",
-		Comparator: gohtn.IntComparator,
-	}
-	conditions["NoCustomersInRange"] = &gohtn.ComparisonCondition[int]{
-		Comparison: gohtn.EQ,
-		Value:      0,
-		Property:   "CustomersInRange",
-		Comparator: gohtn.IntComparator,
-	}
-	htnEngine.Conditions = conditions
-
-	htnEngine.Conditions["CustomerIsNPC"] = &gohtn.FuncCondition{
+	actorConditions["CustomerIsNPC"] = &gohtn.FuncActorCondition{
 		Name: "CustomerIsNPC",
-		Evaluator: func(state *gohtn.State) bool {
-			// TODO: fetch the current customer for the vendor and check if they are an NPC
-			return false
+		Evaluator: func(a actor.Actor, state *gohtn.State) bool {
+			return a.IsNPC()
 		},
 	}
-	htnEngine.Conditions["CustomerIsPlayer"] = &gohtn.FuncCondition{
-		Name: "CustomerIsNPC",
-		Evaluator: func(state *gohtn.State) bool {
-			// TODO: fetch the current customer for the vendor and check if they are the player
-			return true
+	actorConditions["CustomerIsPlayer"] = &gohtn.FuncActorCondition{
+		Name: "CustomerIsPlayer",
+		Evaluator: func(a actor.Actor, state *gohtn.State) bool {
+			return !a.IsNPC()
 		},
 	}
 
-	htnEngine.Actions["Wait"] = func(state *gohtn.State) error {
-		log.Println("waiting")
-		return nil
+	actions := make(engine.Actions)
+	// Wait keeps running until its deadline passes on the clock of the engine, rather than sleeping through the tick
+	actions["Wait"] = func(ctx context.Context, state *gohtn.State) (gohtn.TaskStatus, error) {
+		now := htnEngine.Clock.Now()
+		status := gohtn.Running
+		err := state.Update(func(state *gohtn.State) error {
+			deadline, ok := state.Properties[waitUntil].(*gohtn.Property[time.Time])
+			if !ok {
+				state.Log().Info("waiting")
+				until := now.Add(100 * time.Millisecond)
+				state.Properties[waitUntil] = &gohtn.Property[time.Time]{
+					Name:  waitUntil,
+					Value: func(state *gohtn.State) time.Time { return until },
+				}
+				return nil
+			}
+			if !now.Before(deadline.Value(state)) {
+				delete(state.Properties, waitUntil)
+				status = gohtn.Succeeded
+			}
+			return nil
+		})
+		return status, err
 	}
 
-	htnEngine.Actions["StartWork"] = func(state *gohtn.State) error {
-		log.Println("starting work shift")
-		return nil
-	}
-	htnEngine.Actions["EndWork"] = func(state *gohtn.State) error {
-		log.Println("ending work shift")
-		return nil
-	}
+	actions["GreetCustomer"] = gohtn.WithContext(func(state *gohtn.State) (gohtn.TaskStatus, error) {
+		customer, err := state.BoundActor("?customer")
+		if err != nil {
+			return gohtn.Failed, err
+		}
+		state.Log().Info("greeting customer", logging.F("customer", customer.Name()))
+		return gohtn.Succeeded, nil
+	})
+
+	actions["StartWork"] = gohtn.WithContext(func(state *gohtn.State) (gohtn.TaskStatus, error) {
+		state.Log().Info("starting work shift")
+		return gohtn.Succeeded, nil
+	})
+	actions["EndWork"] = gohtn.WithContext(func(state *gohtn.State) (gohtn.TaskStatus, error) {
+		state.Log().Info("ending work shift")
+		return gohtn.Succeeded, nil
+	})
 
-	log.Println("loading sensors")
+	logger.Info("loading sensors")
 
-	now := time.Now()
+	now := htnEngine.Clock.Now()
 	hourOfDaySensor := &gohtn.HourOfDaySensor{
 		TickSensor: gohtn.TickSensor{
 			StartedAt:    now,
 			TickDuration: 10 * time.Second,
+			Clock:        htnEngine.Clock,
+			Logger:       logger,
 		},
 	}
 	htnEngine.Sensors["HourOfDay"] = hourOfDaySensor
@@ -130,36 +193,62 @@ func initializeEngine(cfg *config.Config) *engine.Engine {
 	customersInRangeSensor := &gohtn.CustomersInRangeSensor{
 		Vendor: vendor,
 		Actors: htnEngine.Actors,
+		Logger: logger,
 	}
 	htnEngine.Sensors["CustomersInRange"] = customersInRangeSensor
 
-	log.Println("loading taskResolvers")
-	taskLoader := &loader.TaskLoader{}
-	taskResolvers, err := taskLoader.LoadTaskResolvers(cfg, htnEngine)
-	if err != nil {
-		panic(err)
-	}
-	log.Printf("Loaded %d taskResolvers", len(taskResolvers))
+	compile := func(cfg *config.Config) (*engine.Domain, error) {
+		logger.Info("loading conditions")
+		conditions, err := loader.LoadConditions(cfg)
+		if err != nil {
+			return nil, err
+		}
 
-	log.Println("loading methods")
-	methods, err := loader.LoadMethods(cfg, taskLoader, htnEngine)
-	if err != nil {
-		panic(err)
-	}
-	htnEngine.Methods = methods
+		conditions["AfterWorkStart"] = &gohtn.ComparisonCondition[int64]{
+			Comparison: gohtn.GTE,
+			Value:      1,
+			Property:   "HourOfDay",
+			Comparator: func(value int64, property int64, comparison gohtn.Comparison) bool {
+				return property >= value
+			},
+		}
+		conditions["BeforeWorkEnd"] = &gohtn.ComparisonCondition[int64]{
+			Comparison: gohtn.LTE,
+			Value:      14,
+			Property:   "HourOfDay",
+			Comparator: func(value int64, property int64, comparison gohtn.Comparison) bool {
+				return property <= value
+			},
+		}
+		conditions["CustomerNotEngaged"] = &gohtn.ComparisonCondition[int64]{
+			Comparison: gohtn.EQ,
+			Value:      0,
+			Property:   "CustomersEngaged",
+			Comparator: gohtn.Int64Comparator,
+		}
+		conditions["CustomersInRange"] = &gohtn.ComparisonCondition[int]{
+			Comparison: gohtn.GT,
+			Value:      0,
+			Property:   "CustomersInRange",
+			Comparator: gohtn.IntComparator,
+		}
+		conditions["NoCustomersInRange"] = &gohtn.ComparisonCondition[int]{
+			Comparison: gohtn.EQ,
+			Value:      0,
+			Property:   "CustomersInRange",
+			Comparator: gohtn.IntComparator,
+		}
 
-	log.Println("loading task graph")
-	taskGraph, err := loader.LoadTaskGraph(cfg, htnEngine)
+		logger.Info("loading domain")
+		return loader.LoadDomain(cfg, conditions, actorConditions, actions, logger)
+	}
+	domain, err := compile(cfg)
 	if err != nil {
 		panic(err)
 	}
-	htnEngine.Domain = taskGraph
+	htnEngine.Domain = domain
 
-	htnEngine.Planner = &gohtn.Planner{
-		Tasks: taskGraph,
-	}
-
-	return htnEngine
+	return htnEngine, compile
 }
 
 func initializeState(htnEngine *engine.Engine) (*gohtn.State, error) {
@@ -169,11 +258,11 @@ func initializeState(htnEngine *engine.Engine) (*gohtn.State, error) {
 		Value: func(state *gohtn.State) int64 {
 			sensor, err := state.Sensor("HourOfDay")
 			if err != nil {
-				log.Fatal(err)
+				panic(err)
 			}
 			val, err := sensor.(*gohtn.HourOfDaySensor).Get()
 			if err != nil {
-				log.Fatal(err)
+				panic(err)
 			}
 			return val
 		},
@@ -184,13 +273,13 @@ func initializeState(htnEngine *engine.Engine) (*gohtn.State, error) {
 		Value: func(state *gohtn.State) int {
 			sensor, err := state.Sensor("CustomersInRange")
 			if err != nil {
-				log.Fatal(err)
+				panic(err)
 			}
 			val, err := sensor.(*gohtn.CustomersInRangeSensor).Get()
 			if err != nil {
-				log.Fatal(err)
+				panic(err)
 			}
-			log.Printf("CustomersInRange property: %d customers in range", val)
+			state.Log().Debug("customers in range", logging.F("customers", val))
 			return val
 		},
 	}
@@ -199,6 +288,7 @@ func initializeState(htnEngine *engine.Engine) (*gohtn.State, error) {
 	return &gohtn.State{
 		Sensors:    htnEngine.Sensors,
 		Properties: properties,
+		Actors:     htnEngine.Actors,
 	}, nil
 }
 
@@ -207,63 +297,101 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	log.Println("initializing HTN engine")
-	htnEngine := initializeEngine(cfg)
+	logger, err := newLogger(cfg)
+	if err != nil {
+		panic(err)
+	}
+	logger.Info("initializing HTN engine")
+	htnEngine, compile := initializeEngine(cfg, logger)
 
 	// Initialize the state from the sensors
-	log.Println("initializing state")
+	logger.Info("initializing state")
 	state, err := initializeState(htnEngine)
 	if err != nil {
 		panic(err)
 	}
-	var iteration = 0
-	var walkingRight = true
-	for {
-		log.Printf("iteration %d", iteration)
-		iteration++
-		plan, err := htnEngine.Planner.Plan(state)
+	var registry *metrics.Registry
+	if len(cfg.MetricsAddress) > 0 {
+		registry = metrics.NewRegistry()
+		htnEngine.Metrics = registry
+	}
+	_, err = htnEngine.AddAgent("Vendor", state)
+	if err != nil {
+		panic(err)
+	}
+	if len(cfg.SnapshotPath) > 0 {
+		err = restoreSnapshot(htnEngine, cfg.SnapshotPath)
 		if err != nil {
 			panic(err)
 		}
-		// We are done when the planner can not find and tasks left to execute
-		if len(plan) == 0 {
-			log.Println("no tasks to execute")
-			break
-		} else {
-			planTasks := make([]string, 0)
-			for _, task := range plan {
-				planTasks = append(planTasks, fmt.Sprintf("{%s}", task.String()))
-			}
-			log.Printf("executing plan tasks:\n%s", strings.Join(planTasks, "\n"))
-			_, err = gohtn.Execute(plan, state)
+	}
+	htnEngine.Events.SubscribeAsync(func(event gohtn.Event) {
+		logger.Info("event", logging.F("event", event.String()))
+	}, 64, engine.Types(gohtn.MethodSelected, gohtn.TaskCompleted, gohtn.TaskFailed, gohtn.PlanAbandoned))
+	// an interrupt cancels the action in flight and stops the loop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if registry != nil {
+		go func() {
+			err := registry.Serve(ctx, cfg.MetricsAddress)
 			if err != nil {
-				panic(err)
+				logger.Error("metrics endpoint stopped", logging.Err(err))
 			}
+		}()
+		logger.Info("serving metrics", logging.F("address", fmt.Sprintf("http://%s/metrics", cfg.MetricsAddress)))
+	}
+	// in watch mode the engine keeps running once idle, so edits to the assets can give it something to do
+	stopConditions := []engine.StopCondition{engine.WhenIdle(), engine.OnError()}
+	if cfg.WatchAssets {
+		watcher := &loader.Watcher{
+			Config:  cfg,
+			Compile: compile,
+			Engine:  htnEngine,
+			Logger:  logger,
 		}
-
+		go func() {
+			err := watcher.Watch(ctx)
+			if err != nil {
+				logger.Error("asset watcher stopped", logging.Err(err))
+			}
+		}()
+		logger.Info("watching assets", logging.F("assetRoot", cfg.AssetRoot))
+		stopConditions = []engine.StopCondition{engine.OnError()}
+	}
+	// Have the player walk back and forth from -20,5 to 20,5 between ticks
+	walkingRight := true
+	htnEngine.TickRate = time.Second
+	htnEngine.AfterTick = func(result *engine.TickResult) {
 		for _, a := range htnEngine.Actors {
-			log.Printf("Actor %s: (%f, %f)", a.Name(), a.Location().X, a.Location().Y)
+			logger.Debug("actor location", logging.Tick(result.Tick), logging.F("actor", a.Name()), logging.F("x", a.Location().X), logging.F("y", a.Location().Y))
 		}
-
-		time.Sleep(time.Second)
-
-		// Have the player walk back and forth from -20,5 to 20,5
 		player := htnEngine.Actors["Player"].(*actor.Player)
-
-		if player.Location().X >= 20 {
+		switch {
+		case player.Location().X >= 20:
 			walkingRight = false
 			player.Location().X = 19
-			continue
-		}
-		if player.Location().X <= -20 {
+		case player.Location().X <= -20:
 			walkingRight = true
 			player.Location().X = -19
-			continue
-		}
-		if walkingRight {
+		case walkingRight:
 			player.Location().X += 1
-		} else {
+		default:
 			player.Location().X -= 1
 		}
+		if len(cfg.SnapshotPath) > 0 {
+			err := saveSnapshot(htnEngine, cfg.SnapshotPath)
+			if err != nil {
+				logger.Error("saving snapshot", logging.Err(err))
+			}
+		}
+	}
+	// We are done when the planner can not find any tasks left to execute
+	result, err := htnEngine.Run(ctx, stopConditions...)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		panic(err)
+	}
+	if err := result.Err(); err != nil {
+		panic(err)
 	}
+	logger.Info("engine stopped", logging.Tick(result.Tick))
 }
@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the histograms without buckets of their own, suited to durations in seconds
+var DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+
+// series is one labelled counter or histogram
+type series struct {
+	labels gohtn.Labels
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// family holds the series of one metric
+type family struct {
+	histogram bool
+	series    map[string]*series
+}
+
+// Registry is a Metrics sink keeping counters and histograms in memory, written in the Prometheus text format
+type Registry struct {
+	help     map[string]string
+	buckets  map[string][]float64
+	families map[string]*family
+	mutex    sync.Mutex
+}
+
+var _ gohtn.Metrics = &Registry{}
+
+// NewRegistry returns a Registry describing the metrics of the Planner and Executor
+func NewRegistry() *Registry {
+	r := &Registry{
+		help:     make(map[string]string),
+		buckets:  map[string][]float64{gohtn.MetricPlanLength: {1, 2, 4, 8, 16, 32, 64, 128}},
+		families: make(map[string]*family),
+	}
+	r.Describe(gohtn.MetricPlansBuilt, "Plans built by the planner.")
+	r.Describe(gohtn.MetricPlanningFailures, "Calls to the planner that failed to build a plan.")
+	r.Describe(gohtn.MetricPlanLength, "Steps in each plan built.")
+	r.Describe(gohtn.MetricPlanningSeconds, "Time taken to build a plan, in seconds.")
+	r.Describe(gohtn.MetricConditionEvaluations, "Conditions evaluated while planning and executing.")
+	r.Describe(gohtn.MetricMethodSelections, "Methods selected by compound tasks.")
+	r.Describe(gohtn.MetricTaskResults, "Tasks that finished an execution, by status.")
+	return r
+}
+
+// Describe sets the help text of a metric
+func (r *Registry) Describe(name string, help string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.help[name] = help
+}
+
+// SetBuckets sets the upper bounds of the buckets of a histogram.  The buckets of a metric that already has samples
+// can not be changed, since its series count against the buckets they were created with.
+func (r *Registry) SetBuckets(name string, bounds []float64) error {
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.families[name]; ok {
+		return fmt.Errorf("metric %s already has samples, its buckets can not be changed", name)
+	}
+	r.buckets[name] = sorted
+	return nil
+}
+
+func (r *Registry) Add(name string, labels gohtn.Labels, delta float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.series(name, labels, false)
+	s.value += delta
+}
+
+func (r *Registry) Observe(name string, labels gohtn.Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	s := r.series(name, labels, true)
+	for i, bound := range r.bounds(name) {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (r *Registry) bounds(name string) []float64 {
+	bounds, ok := r.buckets[name]
+	if !ok {
+		return DefaultBuckets
+	}
+	return bounds
+}
+
+// series returns the series of the metric with the labels, creating it on first use
+func (r *Registry) series(name string, labels gohtn.Labels, histogram bool) *series {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{histogram: histogram, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	key := formatLabels(labels, "", 0)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: make(gohtn.Labels, len(labels))}
+		for name, value := range labels {
+			s.labels[name] = value
+		}
+		if histogram {
+			s.counts = make([]uint64, len(r.bounds(name)))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := strings.Builder{}
+	for _, name := range names {
+		f := r.families[name]
+		if help, ok := r.help[name]; ok {
+			out.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+		}
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if !f.histogram {
+			out.WriteString(fmt.Sprintf("# TYPE %s counter\n", name))
+			for _, key := range keys {
+				out.WriteString(fmt.Sprintf("%s%s %s\n", name, key, formatValue(f.series[key].value)))
+			}
+			continue
+		}
+		out.WriteString(fmt.Sprintf("# TYPE %s histogram\n", name))
+		bounds := r.bounds(name)
+		for _, key := range keys {
+			s := f.series[key]
+			for i, bound := range bounds {
+				out.WriteString(fmt.Sprintf("%s_bucket%s %d\n", name, formatLabels(s.labels, "le", bound), s.counts[i]))
+			}
+			out.WriteString(fmt.Sprintf("%s_bucket%s %d\n", name, formatLabels(s.labels, "le", math.Inf(1)), s.count))
+			out.WriteString(fmt.Sprintf("%s_sum%s %s\n", name, key, formatValue(s.sum)))
+			out.WriteString(fmt.Sprintf("%s_count%s %d\n", name, key, s.count))
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// Serve serves the metrics on the /metrics path of the address, e.g. "127.0.0.1:9464", until the context is done
+func (r *Registry) Serve(ctx context.Context, address string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	server := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// formatLabels writes the labels sorted by name, along with the extra label when it is named
+func formatLabels(labels gohtn.Labels, extra string, value float64) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escaper.Replace(labels[name])))
+	}
+	if len(extra) > 0 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra, formatValue(value)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ","))
+}
+
+// escaper escapes the backslashes, quotes and line feeds of label values, the only escapes the text format knows
+var escaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
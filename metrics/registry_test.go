@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/cory-johannsen/gohtn/gohtn"
+	"testing"
+)
+
+const golden = `# HELP greetings_total Customers greeted.
+# TYPE greetings_total counter
+greetings_total{agent="Vendor",customer="Bob \"the \\\\ builder\"\nSmith"} 1
+greetings_total{agent="Vendor",customer="Player"} 2.5
+# TYPE haggle_seconds histogram
+haggle_seconds_bucket{agent="Vendor",le="0.5"} 1
+haggle_seconds_bucket{agent="Vendor",le="1"} 2
+haggle_seconds_bucket{agent="Vendor",le="+Inf"} 3
+haggle_seconds_sum{agent="Vendor"} 4.2
+haggle_seconds_count{agent="Vendor"} 3
+`
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	registry.Describe("greetings_total", "Customers greeted.")
+	err := registry.SetBuckets("haggle_seconds", []float64{1, 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry.Add("greetings_total", gohtn.Labels{"agent": "Vendor", "customer": "Player"}, 1)
+	registry.Add("greetings_total", gohtn.Labels{"agent": "Vendor", "customer": "Player"}, 1.5)
+	registry.Add("greetings_total", gohtn.Labels{"agent": "Vendor", "customer": "Bob \"the \\\\ builder\"\nSmith"}, 1)
+	for _, value := range []float64{0.25, 0.75, 3.2} {
+		registry.Observe("haggle_seconds", gohtn.Labels{"agent": "Vendor"}, value)
+	}
+	var buffer bytes.Buffer
+	err = registry.WriteText(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != golden {
+		t.Fatalf("expected\n%s\ngot\n%s", golden, buffer.String())
+	}
+}
+
+func TestSetBucketsIsRejectedOnceAHistogramHasSamples(t *testing.T) {
+	registry := NewRegistry()
+	registry.Observe("haggle_seconds", nil, 0.3)
+	err := registry.SetBuckets("haggle_seconds", []float64{1, 2})
+	if err == nil {
+		t.Fatal("expected the buckets of a histogram with samples to be kept")
+	}
+	registry.Observe("haggle_seconds", gohtn.Labels{"agent": "Vendor"}, 1.5)
+	var buffer bytes.Buffer
+	err = registry.WriteText(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buffer.Bytes(), []byte(`haggle_seconds_bucket{le="2.5"} 1`)) {
+		t.Fatalf("expected the default buckets, got\n%s", buffer.String())
+	}
+}